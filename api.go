@@ -0,0 +1,141 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+const defaultBaseUrl = "https://api.automationcloud.net"
+
+// JobOutput is an output of a job as listed by api.
+type JobOutput struct {
+	Key   string      `json:"key"`
+	Stage string      `json:"stage,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// FetchOutputs loads all outputs of current job.
+func (jr *JobRunner) FetchOutputs() (outputs []JobOutput, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return jr.fetchOutputs()
+}
+
+func (jr *JobRunner) fetchOutputs() (outputs []JobOutput, err error) {
+	if jr.Job == nil {
+		return nil, errors.New("job runner is not ready to fetch outputs: no job created or resumed")
+	}
+
+	var body struct {
+		Data []JobOutput `json:"data"`
+	}
+	err = jr.apiRequest("GET", "/jobs/"+jr.Job.Id+"/outputs", nil, &body)
+	return body.Data, err
+}
+
+// DecodeOutput loads output of current job and decodes its data into v, e.g. a struct generated by jobrunner-gen.
+func (jr *JobRunner) DecodeOutput(key string, v interface{}) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	data, err := jr.fetchOutput(key)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(b, v)
+}
+
+// fetchOutput loads data of current job output, unlike cl.Job.GetOutput it keeps numbers exact.
+func (jr *JobRunner) fetchOutput(key string) (data interface{}, err error) {
+	if jr.Job == nil {
+		return nil, errors.New("job runner is not ready to fetch outputs: no job created or resumed")
+	}
+
+	var output JobOutput
+	err = jr.apiRequest("GET", "/jobs/"+jr.Job.Id+"/outputs/"+key, nil, &output)
+	return output.Data, err
+}
+
+// apiRequest calls automation cloud api endpoints not covered by client-go,
+// errors are reported the same way client-go does.
+func (jr *JobRunner) apiRequest(method, path string, payload, result interface{}) error {
+	return jr.apiRequestContext(context.Background(), method, path, payload, result)
+}
+
+// apiRequestContext is apiRequest aborted when ctx is done.
+func (jr *JobRunner) apiRequestContext(ctx context.Context, method, path string, payload, result interface{}) (err error) {
+	var data io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		data = bytes.NewBuffer(b)
+	}
+
+	baseUrl := jr.baseUrl
+	if baseUrl == "" {
+		baseUrl = defaultBaseUrl
+	}
+
+	req, err := http.NewRequest(method, baseUrl+path, data)
+	if err != nil {
+		return
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if jr.apiClient.SecretKey != "" {
+		req.SetBasicAuth(jr.apiClient.SecretKey, "")
+	}
+
+	res, err := jr.apiClient.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	switch {
+	case 500 <= res.StatusCode && res.StatusCode <= 599:
+		return cl.ErrServer
+	case res.StatusCode == 400:
+		var b struct {
+			Details struct {
+				Messages []string `json:"messages"`
+			} `json:"details"`
+		}
+		if err = readJSON(res.Body, &b); err == nil {
+			err = cl.ValidationError{Messages: b.Details.Messages}
+		}
+		return
+	case 400 < res.StatusCode && res.StatusCode <= 499:
+		return cl.ErrClient
+	}
+
+	if result == nil {
+		return
+	}
+
+	return readJSON(res.Body, result)
+}
+
+func readJSON(r io.Reader, result interface{}) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return decodeJSON(body, result)
+}
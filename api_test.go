@@ -0,0 +1,53 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestApiRequest(t *testing.T) {
+	respond := func(status int, body string) *JobRunner {
+		client := newTestClient(func(req *http.Request) *http.Response {
+			if user, _, _ := req.BasicAuth(); user != "apikey" {
+				t.Errorf("expected request to be authenticated, got %q", user)
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+				Header:     make(http.Header),
+			}
+		})
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		return &jr
+	}
+
+	t.Run("happy case", func(t *testing.T) {
+		var result map[string]string
+		err := respond(200, `{"id": "job-id"}`).apiRequest("GET", "/jobs/job-id", nil, &result)
+		if err != nil || result["id"] != "job-id" {
+			t.Errorf("unexpected result %v, %v", result, err)
+		}
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		err := respond(400, `{"details": {"messages": ["/input/url should be string"]}}`).apiRequest("POST", "/jobs", nil, nil)
+		expectError(t, "validation failed: /input/url should be string", err)
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		err := respond(404, ``).apiRequest("GET", "/jobs/job-id", nil, nil)
+		expectError(t, "client error", err)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		err := respond(502, ``).apiRequest("GET", "/jobs/job-id", nil, nil)
+		expectError(t, "server error", err)
+	})
+
+	t.Run("no job", func(t *testing.T) {
+		_, err := respond(200, ``).FetchOutputs()
+		expectError(t, "job runner is not ready to fetch outputs: no job created or resumed", err)
+	})
+}
@@ -0,0 +1,257 @@
+package jobrunner
+
+import (
+	"context"
+	"time"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// EventJobCanceled is recorded when job is canceled by runner.
+const EventJobCanceled = "jobCanceled"
+
+// TimeoutError is returned when job exceeds its time limits and gets canceled.
+type TimeoutError struct {
+	JobId  string
+	Reason string
+}
+
+// Error makes string representation of a timeout error.
+func (e TimeoutError) Error() string {
+	return "job " + e.JobId + " " + e.Reason
+}
+
+// jobState holds what runner knows about a job besides api representation.
+type jobState struct {
+	startedAt     time.Time
+	awaitingKey   string
+	awaitingSince time.Time
+	// answered holds data sent for inputs by key and stage.
+	answered map[string]interface{}
+	// domainId is domain job was created or resumed with, see poll.
+	domainId string
+	// inputData is data generated for the job, jobIndex is its position among jobs of the same run.
+	inputData map[string]interface{}
+	jobIndex  int
+	// faults holds input keys faults were injected into, see JobRun.Faults.
+	faults map[string]bool
+	// thought is input key and stage runner pauses for until thinkUntil, see JobRun.ThinkTimes.
+	thought    string
+	thinkUntil time.Time
+}
+
+// isFinished reports whether job in given state will not change anymore.
+func isFinished(state string) bool {
+	switch state {
+	case "success", "fail", "canceled":
+		return true
+	}
+	return false
+}
+
+// unfinished filters out jobs which will not change anymore.
+func unfinished(jobs []*cl.Job) (live []*cl.Job) {
+	for _, job := range jobs {
+		if !isFinished(job.State) {
+			live = append(live, job)
+		}
+	}
+	return
+}
+
+// track registers job in jr.Jobs, already known job with the same id gets updated.
+func (jr *JobRunner) track(job cl.Job) *cl.Job {
+	for _, j := range jr.Jobs {
+		if j.Id == job.Id {
+			*j = job
+			jr.observe(j)
+			return j
+		}
+	}
+
+	jr.Jobs = append(jr.Jobs, &job)
+	jr.observe(&job)
+	return &job
+}
+
+// observe updates state of a job: when it started and since when it awaits current input,
+// unfinished jobs are kept in process-wide registry used by Shutdown.
+func (jr *JobRunner) observe(job *cl.Job) *jobState {
+	if isFinished(job.State) {
+		registry.remove(job.Id)
+	} else {
+		registry.add(job.Id, jr, jr.JobRun.ServiceId)
+	}
+
+	if jr.states == nil {
+		jr.states = make(map[string]*jobState)
+	}
+
+	now := timeNow()
+	state, ok := jr.states[job.Id]
+	if !ok {
+		state = &jobState{startedAt: job.CreatedAt.Time}
+		if state.startedAt.IsZero() {
+			state.startedAt = now
+		}
+		jr.states[job.Id] = state
+	}
+
+	switch {
+	case job.State != "awaitingInput":
+		state.awaitingKey = ""
+	case state.awaitingKey != job.AwaitingInputKey:
+		state.awaitingKey = job.AwaitingInputKey
+		state.awaitingSince = now
+	}
+	return state
+}
+
+// checkLimits returns TimeoutError when job exceeded JobRun.Timeout
+// or awaits the same input longer than JobRun.InputTimeout.
+func (jr *JobRunner) checkLimits(job *cl.Job) error {
+	if isFinished(job.State) {
+		return nil
+	}
+
+	state := jr.observe(job)
+	now := timeNow()
+	if jr.JobRun.Timeout > 0 && now.Sub(state.startedAt) > jr.JobRun.Timeout {
+		return TimeoutError{job.Id, "exceeded timeout of " + jr.JobRun.Timeout.String()}
+	}
+
+	if jr.JobRun.InputTimeout > 0 && state.awaitingKey != "" && now.Sub(state.awaitingSince) > jr.JobRun.InputTimeout {
+		return TimeoutError{job.Id, "awaited input " + state.awaitingKey + " longer than " + jr.JobRun.InputTimeout.String()}
+	}
+
+	return nil
+}
+
+// enforceLimits cancels job which exceeded its time limits.
+func (jr *JobRunner) enforceLimits(job *cl.Job) error {
+	err := jr.checkLimits(job)
+	if err == nil {
+		return nil
+	}
+
+	if cancelErr := jr.cancelJob(job, err.Error()); cancelErr != nil {
+		return cancelErr
+	}
+	return err
+}
+
+// CancelJob cancels all unfinished jobs created or resumed by the runner.
+// Unlike cl.Job.Cancel it cancels jobs in any state, not only awaiting input.
+func (jr *JobRunner) CancelJob() (err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	for _, job := range jr.Jobs {
+		if isFinished(job.State) {
+			continue
+		}
+		if cancelErr := jr.cancelJob(job, "canceled by runner"); cancelErr != nil && err == nil {
+			err = cancelErr
+		}
+	}
+	return
+}
+
+func (jr *JobRunner) cancelJob(job *cl.Job, reason string) error {
+	if err := jr.apiRequest("POST", "/jobs/"+job.Id+"/cancel", nil, nil); err != nil {
+		return err
+	}
+
+	jr.record(Event{JobId: job.Id, Type: EventJobCanceled, Message: reason})
+	return jr.fetch(job)
+}
+
+// fetch reloads job, unlike cl.Job.Fetch it reports an error.
+func (jr *JobRunner) fetch(job *cl.Job) error {
+	if err := jr.apiRequest("GET", "/jobs/"+job.Id, nil, job); err != nil {
+		return err
+	}
+
+	jr.observe(job)
+	return nil
+}
+
+// Refresh reloads all unfinished jobs and cancels ones exceeding JobRun.Timeout or JobRun.InputTimeout,
+// TimeoutError is returned in such case.
+func (jr *JobRunner) Refresh() (err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return jr.refresh()
+}
+
+func (jr *JobRunner) refresh() (err error) {
+	for _, job := range jr.Jobs {
+		if isFinished(job.State) {
+			continue
+		}
+		if err := jr.fetch(job); err != nil {
+			return err
+		}
+		if limitErr := jr.enforceLimits(job); limitErr != nil && err == nil {
+			err = limitErr
+		}
+	}
+	return
+}
+
+// Poll refreshes jobs every interval and creates inputs they await until all jobs are finished.
+// Polling stops with an error when input can not be created, job exceeds its limits or ctx is done.
+func (jr *JobRunner) Poll(ctx context.Context, interval time.Duration) error {
+	for {
+		finished, err := jr.poll()
+		if err != nil || finished {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll makes a single polling iteration, runner is locked for its duration but not between iterations.
+// Each job awaiting input becomes current one while input is created, current job is restored afterwards.
+func (jr *JobRunner) poll() (finished bool, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	current, domainId := jr.Job, jr.DomainId
+	defer func() { jr.Job, jr.DomainId = current, domainId }()
+
+	if err := jr.refresh(); err != nil {
+		return false, err
+	}
+
+	finished = true
+	for _, job := range jr.Jobs {
+		if isFinished(job.State) {
+			continue
+		}
+		finished = false
+		if job.State == "awaitingInput" {
+			jr.Job = job
+			if state := jr.observe(job); state.domainId != "" {
+				jr.DomainId = state.domainId
+			}
+			pause, err := jr.think()
+			if err != nil {
+				return false, err
+			}
+			if pause > 0 {
+				// input is created by a later iteration once think time passes
+				continue
+			}
+			if err := jr.createInput(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,208 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCancelJob(t *testing.T) {
+	var canceled []string
+	created := 0
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			body = `{}`
+		case "POST http://api/jobs":
+			created++
+			body = fmt.Sprintf(`{"id": "job-%d", "state": "processing"}`, created)
+		case "POST http://api/jobs/job-1/cancel", "POST http://api/jobs/job-2/cancel",
+			"POST http://api/jobs/job-3/cancel", "POST http://api/jobs/job-4/cancel":
+			canceled = append(canceled, req.URL.Path)
+		case "GET http://api/jobs/job-1", "GET http://api/jobs/job-2", "GET http://api/jobs/job-3", "GET http://api/jobs/job-4":
+			body = `{"id": "` + req.URL.Path[len("/jobs/"):] + `", "state": "fail"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	if _, err := jr.RunJob(JobRun{ServiceId: "service-id", HowMany: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(jr.Jobs) != 2 || jr.Jobs[0].Id != "job-1" || jr.Job.Id != "job-2" {
+		t.Fatalf("expected both jobs to be tracked, got %v", jr.Jobs)
+	}
+
+	if err := jr.CancelJob(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(canceled, []string{"/jobs/job-1/cancel", "/jobs/job-2/cancel"}) {
+		t.Errorf("expected both jobs to be canceled, got %v", canceled)
+	}
+	if jr.Jobs[0].State != "fail" {
+		t.Errorf("expected job to be reloaded after cancellation, got %v", jr.Jobs[0].State)
+	}
+
+	canceled = nil
+	if err := jr.CancelJob(); err != nil || len(canceled) != 0 {
+		t.Errorf("expected finished jobs not to be canceled, got %v, %v", canceled, err)
+	}
+
+	t.Run("jobs of earlier runs", func(t *testing.T) {
+		canceled = nil
+		jr.RunJob(JobRun{ServiceId: "service-id"})
+		if _, err := jr.RunJob(JobRun{Matrix: map[string][]interface{}{"cabin": {"economy"}}}); err == nil {
+			t.Fatal("expected job run with matrix to fail")
+		}
+		jr.RunJob(JobRun{ServiceId: "service-id"})
+		if len(jr.Jobs) != 2 || jr.Jobs[0].Id != "job-3" || jr.Job.Id != "job-4" {
+			t.Fatalf("expected unfinished job of earlier run to stay tracked and finished ones to be dropped, got %v", jr.Jobs)
+		}
+
+		if err := jr.CancelJob(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(canceled, []string{"/jobs/job-3/cancel", "/jobs/job-4/cancel"}) {
+			t.Errorf("expected job of earlier run to be canceled too, got %v", canceled)
+		}
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	job := `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "finalPriceConsent", "createdAt": %d}`
+	createdAt := time.Now().UnixNano() / int64(time.Millisecond)
+	canceled := false
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = fmt.Sprintf(job, createdAt)
+		case "POST http://api/jobs/job-id/cancel":
+			canceled = true
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	t.Run("wall-clock budget", func(t *testing.T) {
+		canceled = false
+		createdAt -= int64(time.Hour / time.Millisecond)
+		defer func() { createdAt += int64(time.Hour / time.Millisecond) }()
+
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Timeout = time.Minute
+		jr.ResumeJob("job-id", "A")
+
+		err := jr.Refresh()
+		expectError(t, "job job-id exceeded timeout of 1m0s", err)
+		if !canceled {
+			t.Error("expected job to be canceled")
+		}
+		if e := jr.Events[0]; e.Type != EventJobCanceled || e.Message != err.Error() {
+			t.Errorf("expected cancellation to be recorded, got %v", e)
+		}
+	})
+
+	t.Run("stuck on input", func(t *testing.T) {
+		canceled = false
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.InputTimeout = time.Millisecond
+		jr.ResumeJob("job-id", "A")
+
+		if err := jr.Refresh(); err != nil || canceled {
+			t.Fatalf("expected job not to be canceled yet, got %v", err)
+		}
+
+		time.Sleep(2 * time.Millisecond)
+		err := jr.CreateInput()
+		expectError(t, "job job-id awaited input finalPriceConsent longer than 1ms", err)
+		if !canceled {
+			t.Error("expected job to be canceled")
+		}
+	})
+}
+
+func TestPoll(t *testing.T) {
+	states := []string{
+		`{"id": "job-id", "state": "processing"}`,
+		`{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "selectedSeats"}`,
+		`{"id": "job-id", "state": "success"}`,
+	}
+	fetches := 0
+	inputs := 0
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = states[fetches]
+			if fetches < len(states)-1 {
+				fetches++
+			}
+		case "GET http://api/jobs/done-id":
+			body = `{"id": "done-id", "state": "success"}`
+		case "POST http://api/jobs/job-id/inputs":
+			inputs++
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.InputData = map[string]interface{}{"selectedSeats": []interface{}{"1A"}}
+	jr.ResumeJob("job-id", "A")
+
+	if err := jr.Poll(context.Background(), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if inputs != 1 || jr.Job.State != "success" {
+		t.Errorf("expected job to complete with one input, got %d inputs, state %v", inputs, jr.Job.State)
+	}
+
+	t.Run("current job is kept", func(t *testing.T) {
+		fetches, inputs = 0, 0
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.InputData = map[string]interface{}{"selectedSeats": []interface{}{"1A"}}
+		jr.ResumeJob("job-id", "A")
+		jr.ResumeJob("done-id", "B")
+
+		if err := jr.Poll(context.Background(), time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if inputs != 1 || jr.Job.Id != "done-id" || jr.DomainId != "B" {
+			t.Errorf("expected input to be sent and current job to stay, got %d inputs, job %v of %s", inputs, jr.Job.Id, jr.DomainId)
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		fetches = 0
+		jr.ResumeJob("job-id", "A")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := jr.Poll(ctx, time.Hour); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
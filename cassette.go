@@ -0,0 +1,284 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// Cassette is a recorded sequence of http interactions of a run: jib, protocol and api calls.
+// Request headers and Set-Cookie response headers are not recorded, so credentials do not leak into cassettes,
+// sensitive data is masked by Recorder.Redactor.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded pair of http request and response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request of an interaction, json body is kept in JSON and any other body in Body.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Body   string          `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response of an interaction, json body is kept in JSON and any other body in Body.
+type RecordedResponse struct {
+	StatusCode int             `json:"statusCode"`
+	Header     http.Header     `json:"header,omitempty"`
+	JSON       json.RawMessage `json:"json,omitempty"`
+	Body       string          `json:"body,omitempty"`
+}
+
+// LoadCassette reads cassette saved by Recorder.
+func LoadCassette(filename string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cassette
+	if err := decodeJSON(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes cassette to a file.
+func (c *Cassette) Save(filename string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+// Recorder is http.RoundTripper which records every interaction made through Transport.
+type Recorder struct {
+	// Transport makes actual requests, http.DefaultTransport is used when nil.
+	Transport http.RoundTripper
+	// Redactor masks sensitive values in recorded request bodies, which Replayer never reads,
+	// and in response bodies when RedactResponses is set. Bodies are recorded as is when nil.
+	Redactor *Redactor
+	// RedactResponses makes Redactor mask response bodies too, replayed runs get masked data then.
+	RedactResponses bool
+	mu              sync.Mutex
+	cassette        Cassette
+}
+
+// NewRecorder creates Recorder making requests through transport, request bodies are redacted by NewRedactor().
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport, Redactor: NewRedactor()}
+}
+
+// RoundTrip makes request and records it along with response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	header := make(http.Header, len(res.Header))
+	for k, v := range res.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Del("Set-Cookie")
+
+	interaction := Interaction{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String()},
+		Response: RecordedResponse{StatusCode: res.StatusCode, Header: header},
+	}
+	interaction.Request.JSON, interaction.Request.Body = splitBody(body)
+	interaction.Request.JSON = redactBody(r.Redactor, interaction.Request.JSON)
+	interaction.Response.JSON, interaction.Response.Body = splitBody(resBody)
+	if r.RedactResponses {
+		interaction.Response.JSON = redactBody(r.Redactor, interaction.Response.JSON)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return res, nil
+}
+
+// Cassette returns a copy of interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction{}, r.cassette.Interactions...)}
+}
+
+func splitBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body), ""
+	}
+	return nil, string(body)
+}
+
+// redactBody masks sensitive values of json body: data of an input or output ({"key": ..., "data": ...}),
+// input of a job ({"input": {...}}) or anything else keyed by input and output keys, e.g. jib response.
+// Body without sensitive values is returned as is.
+func redactBody(r *Redactor, body json.RawMessage) json.RawMessage {
+	if r == nil || body == nil {
+		return body
+	}
+
+	var data interface{}
+	if err := decodeJSON(body, &data); err != nil {
+		return body
+	}
+
+	redacted := r.Redact(data)
+	if m, ok := data.(map[string]interface{}); ok {
+		key, keyed := m["key"].(string)
+		input, isJob := m["input"].(map[string]interface{})
+		if keyed || isJob {
+			copied := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				copied[k] = v
+			}
+			if keyed {
+				copied["data"] = r.RedactKey(key, m["data"])
+			} else {
+				copied["input"] = r.Redact(input)
+			}
+			redacted = copied
+		}
+	}
+	if jsonEqual(redacted, data) {
+		return body
+	}
+
+	b, err := json.Marshal(redacted)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// Replayer is http.RoundTripper which serves interactions of a cassette in order without making requests.
+// Request must have the same method and url as recorded one.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	next     int
+}
+
+// NewReplayer creates Replayer serving interactions of cassette.
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{cassette: cassette}
+}
+
+// RoundTrip serves next recorded response.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request := req.Method + " " + req.URL.String()
+	if r.next >= len(r.cassette.Interactions) {
+		return nil, fmt.Errorf("cassette has no more interactions, got %s", request)
+	}
+
+	interaction := r.cassette.Interactions[r.next]
+	if recorded := interaction.Request.Method + " " + interaction.Request.URL; recorded != request {
+		return nil, fmt.Errorf("cassette interaction %d is %s, got %s", r.next, recorded, request)
+	}
+	r.next++
+
+	body := []byte(interaction.Response.Body)
+	if interaction.Response.JSON != nil {
+		body = interaction.Response.JSON
+	}
+	header := interaction.Response.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(interaction.Response.StatusCode) + " " + http.StatusText(interaction.Response.StatusCode),
+		StatusCode: interaction.Response.StatusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// Remaining returns number of interactions not served yet.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cassette.Interactions) - r.next
+}
+
+// Transport returns http.RoundTripper runner makes requests through.
+func (jr *JobRunner) Transport() http.RoundTripper {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	if jr.httpClient == nil || jr.httpClient.Transport == nil {
+		return http.DefaultTransport
+	}
+	return jr.httpClient.Transport
+}
+
+// WithTransport makes runner send jib, protocol and api requests through transport, e.g. Recorder or Replayer.
+// http.Client runner was created with is not modified. Transport should be installed before jobs are created or resumed,
+// already known jobs keep sending inputs through previous transport.
+func (jr *JobRunner) WithTransport(transport http.RoundTripper) *JobRunner {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	client := &http.Client{}
+	if jr.httpClient != nil {
+		*client = *jr.httpClient
+	}
+	client.Transport = transport
+	jr.httpClient = client
+
+	apiClient := cl.NewApiClient(client, jr.apiClient.SecretKey).WithBaseURL(jr.baseUrl)
+	if jr.protocolUrl != "" {
+		apiClient.WithProtocolURL(jr.protocolUrl)
+	}
+	jr.apiClient = apiClient
+	return jr
+}
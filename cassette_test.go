@@ -0,0 +1,142 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassettes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "run.json")
+
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		status := 200
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			body = `{"url": "http://ubio.air/", "passengers": [{"name": "Bob"}], "payment": {"card": {"pan": "4111111111111111"}}}`
+		case "POST http://api/jobs":
+			body = `{"id": "job-id", "state": "processing"}`
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		case "POST http://api/jobs/job-id/inputs":
+			body = `{}`
+			status = 201
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     http.Header{"Set-Cookie": {"session=secret-session"}, "Content-Type": {"application/json"}},
+		}
+	})
+
+	run := func(jr *JobRunner) []string {
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", DomainId: "Flight"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := jr.ResumeJob("job-id", "Flight"); err != nil {
+			t.Fatal(err)
+		}
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		var events []string
+		for _, e := range jr.Timeline() {
+			events = append(events, e.Type+" "+e.Key+" "+toJSON(e.Data))
+		}
+		return events
+	}
+
+	jr := NewRunner(client, "secret", "http://api", "http://jib")
+	recorder := NewRecorder(jr.Transport())
+	recorded := run(jr.WithTransport(recorder))
+	if err := recorder.Cassette().Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("records interactions", func(t *testing.T) {
+		cassette, err := LoadCassette(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cassette.Interactions) != 4 {
+			t.Fatalf("expected 4 interactions, got %d", len(cassette.Interactions))
+		}
+		input := cassette.Interactions[3]
+		if input.Request.URL != "http://api/jobs/job-id/inputs" || toJSON(input.Request.JSON) != `{"key":"passengers","data":[{"name":"Bob"}]}` {
+			t.Errorf("unexpected request %v", input.Request)
+		}
+		if input.Response.StatusCode != 201 || toJSON(input.Response.JSON) != `{}` {
+			t.Errorf("unexpected response %v", input.Response)
+		}
+		if json, body := splitBody([]byte("Server error")); json != nil || body != "Server error" {
+			t.Errorf("expected non-json body to be kept as text, got %s, %s", json, body)
+		}
+
+		b, _ := ioutil.ReadFile(filename)
+		if strings.Contains(string(b), "Authorization") || strings.Contains(string(b), "secret-session") {
+			t.Errorf("expected credentials not to be recorded")
+		}
+		if header := cassette.Interactions[1].Response.Header; header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected other response headers to be recorded, got %v", header)
+		}
+
+		create := cassette.Interactions[1].Request
+		if strings.Contains(string(create.JSON), "4111111111111111") || !strings.Contains(string(create.JSON), RedactedValue) {
+			t.Errorf("expected card number to be redacted in request, got %s", create.JSON)
+		}
+		if jib := cassette.Interactions[0].Response; !strings.Contains(string(jib.JSON), "4111111111111111") {
+			t.Errorf("expected responses not to be redacted by default, got %s", jib.JSON)
+		}
+	})
+
+	t.Run("redacts responses", func(t *testing.T) {
+		recorder := NewRecorder(client.Transport)
+		recorder.RedactResponses = true
+		jr := NewRunner(client, "secret", "http://api", "http://jib")
+		jr.WithTransport(recorder)
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", DomainId: "Flight"}); err != nil {
+			t.Fatal(err)
+		}
+		if jib := recorder.Cassette().Interactions[0].Response; strings.Contains(string(jib.JSON), "4111111111111111") {
+			t.Errorf("expected card number to be redacted in response, got %s", jib.JSON)
+		}
+	})
+
+	t.Run("replays interactions", func(t *testing.T) {
+		cassette, _ := LoadCassette(filename)
+		replayer := NewReplayer(cassette)
+		offline := newTestClient(func(req *http.Request) *http.Response {
+			panic("unexpected request: " + req.URL.String())
+		})
+		jr := NewRunner(offline, "secret", "http://api", "http://jib")
+		replayed := run(jr.WithTransport(replayer))
+		if strings.Join(replayed, "\n") != strings.Join(recorded, "\n") {
+			t.Errorf("expected replayed timeline\n%v\nto match recorded\n%v", replayed, recorded)
+		}
+		if replayer.Remaining() != 0 {
+			t.Errorf("expected all interactions to be replayed, %d remaining", replayer.Remaining())
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		cassette, _ := LoadCassette(filename)
+		jr := NewRunner(nil, "secret", "http://api", "http://jib")
+		jr.WithTransport(NewReplayer(cassette))
+		err := jr.ResumeJob("job-id", "Flight")
+		if err == nil || !strings.Contains(err.Error(), "cassette interaction 0 is POST http://jib, got GET http://api/jobs/job-id") {
+			t.Errorf("expected mismatch error, got %v", err)
+		}
+	})
+}
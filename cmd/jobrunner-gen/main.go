@@ -0,0 +1,72 @@
+// Command jobrunner-gen generates Go types and typed job runner helpers from automation cloud protocol schema.
+//
+// Usage:
+//
+//	jobrunner-gen -schema schema.json -package protocol -out protocol/protocol.go
+//
+// Schema is read from a file or loaded from url, latest published protocol is used by default.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	jobrunner "github.com/automationcloud/job-runner"
+)
+
+func main() {
+	schema := flag.String("schema", "https://protocol.automationcloud.net/schema.json", "protocol schema file or url")
+	pkg := flag.String("package", "protocol", "package name of generated code")
+	out := flag.String("out", "", "output file, stdout when empty")
+	flag.Parse()
+
+	if err := run(*schema, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "jobrunner-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(schema, pkg, out string) error {
+	b, err := readSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("invalid protocol schema: %v", err)
+	}
+
+	src, err := jobrunner.GenerateCode(doc, pkg)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
+
+func readSchema(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return ioutil.ReadFile(location)
+	}
+
+	res, err := http.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unable to load protocol schema: %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
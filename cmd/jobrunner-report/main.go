@@ -0,0 +1,63 @@
+// Command jobrunner-report converts json report of job runs into a report of another format.
+//
+// Usage:
+//
+//	jobrunner-report -reporter junit -in results.json -out junit.xml
+//
+// Input is a report written by json reporter, available reporters are listed in jobrunner.Reporters.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	jobrunner "github.com/automationcloud/job-runner"
+)
+
+func main() {
+	reporter := flag.String("reporter", "junit", "reporter writing the report: html, json or junit")
+	in := flag.String("in", "", "json report file, stdin when empty")
+	out := flag.String("out", "", "output file, stdout when empty")
+	flag.Parse()
+
+	if err := run(*reporter, *in, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "jobrunner-report:", err)
+		os.Exit(1)
+	}
+}
+
+func run(name, in, out string) error {
+	report, err := jobrunner.ReporterByName(name)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if in != "" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	results, err := jobrunner.ReadJSONReport(r)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return report(os.Stdout, results)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := report(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
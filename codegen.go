@@ -0,0 +1,266 @@
+package jobrunner
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GenerateCode generates Go source of package pkg with types of inputs and outputs of every domain
+// defined in protocol schema, along with typed helpers, e.g. runner.Flight().AnswerFinalPriceConsent(data).
+// Schemas of definitions are looked up the same way input validation does, definitions without schema
+// get interface{} type. Numbers are json.Number, so exact values are kept.
+func GenerateCode(schema map[string]interface{}, pkg string) ([]byte, error) {
+	domains, _ := schema["domains"].(map[string]interface{})
+	domainIds := sortedKeys(domains)
+
+	var helpers bytes.Buffer
+	g := &codeGenerator{doc: schema, named: make(map[string]bool), refs: make(map[string]string)}
+	for _, domainId := range domainIds {
+		domain, _ := domains[domainId].(map[string]interface{})
+		g.domainId = domainId
+		g.resolve = protocolResolver(schema, domainId)
+		prefix := exportedName(domainId)
+		domainType := g.uniqueName(prefix + "Domain")
+
+		fmt.Fprintf(&helpers, "// %s answers inputs and reads outputs of %s jobs.\n", domainType, domainId)
+		fmt.Fprintf(&helpers, "type %s struct {\n*jobrunner.JobRunner\n}\n\n", domainType)
+		fmt.Fprintf(&helpers, "// %s returns helpers of %s domain.\n", prefix, domainId)
+		fmt.Fprintf(&helpers, "func (r Runner) %s() %s {\nreturn %s{r.JobRunner}\n}\n\n", prefix, domainType, domainType)
+
+		inputs, _ := domain["inputs"].(map[string]interface{})
+		for _, key := range sortedKeys(inputs) {
+			typeName := g.uniqueName(prefix + exportedName(key) + "Input")
+			s, path := g.definition("inputs", key)
+			g.define(typeName, s, path)
+			fmt.Fprintf(&helpers, "// Answer%s sends %s input.\n", exportedName(key), key)
+			fmt.Fprintf(&helpers, "func (d %s) Answer%s(data %s) error {\nreturn d.SendInput(%q, data)\n}\n\n", domainType, exportedName(key), typeName, key)
+		}
+
+		outputs, _ := domain["outputs"].(map[string]interface{})
+		for _, key := range sortedKeys(outputs) {
+			typeName := g.uniqueName(prefix + exportedName(key) + "Output")
+			s, path := g.definition("outputs", key)
+			g.define(typeName, s, path)
+			fmt.Fprintf(&helpers, "// Output%s loads %s output.\n", exportedName(key), key)
+			fmt.Fprintf(&helpers, "func (d %s) Output%s() (data %s, err error) {\nerr = d.DecodeOutput(%q, &data)\nreturn\n}\n\n", domainType, exportedName(key), typeName, key)
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by jobrunner-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	src.WriteString("import (\n")
+	if strings.Contains(g.decls.String(), "json.Number") {
+		src.WriteString("\"encoding/json\"\n\n")
+	}
+	src.WriteString("jobrunner \"github.com/automationcloud/job-runner\"\n)\n\n")
+	src.WriteString("// Runner wraps job runner with typed helpers of protocol domains.\n")
+	src.WriteString("type Runner struct {\n*jobrunner.JobRunner\n}\n\n")
+	src.Write(helpers.Bytes())
+	src.Write(g.decls.Bytes())
+
+	return format.Source(src.Bytes())
+}
+
+type codeGenerator struct {
+	doc      map[string]interface{}
+	domainId string
+	resolve  schemaResolver
+	decls    bytes.Buffer
+	// named holds generated type names, refs maps locations of referenced schemas to their types.
+	named map[string]bool
+	refs  map[string]string
+}
+
+// definition returns schema of domain input or output and its location, definition without schema is located itself.
+func (g *codeGenerator) definition(kind, key string) (map[string]interface{}, string) {
+	schema, path, found := definitionSchema(g.doc, g.domainId, kind, key)
+	if !found {
+		return nil, "#/domains/" + escapePointer(g.domainId) + "/" + kind + "/" + escapePointer(key)
+	}
+	return schema, path
+}
+
+// uniqueName returns name not used by generated types yet, numeric suffix is added when needed.
+func (g *codeGenerator) uniqueName(name string) string {
+	unique := name
+	for i := 2; g.named[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.named[unique] = true
+	return unique
+}
+
+// define declares named type for schema located at path, name must be reserved with uniqueName.
+func (g *codeGenerator) define(name string, schema map[string]interface{}, path string) {
+	var body string
+	if _, isStruct := schema["properties"].(map[string]interface{}); isStruct && schemaType(schema) == "object" {
+		body = g.structType(name, schema, path)
+	} else {
+		body = g.goType(schema, name, path)
+	}
+	fmt.Fprintf(&g.decls, "// %s is generated from %s.\ntype %s %s\n\n", name, path, name, body)
+}
+
+// goType returns Go type for schema, nested objects become named types prefixed with name.
+func (g *codeGenerator) goType(schema map[string]interface{}, name, path string) string {
+	if schema == nil {
+		return "interface{}"
+	}
+
+	if resolved, refPath, ok := g.resolve(schema); ok {
+		refName, seen := g.refs[refPath]
+		if !seen {
+			// types shared by domains are named without domain prefix
+			segments := strings.Split(refPath, "/")
+			refName = exportedName(segments[len(segments)-1])
+			if strings.HasPrefix(refPath, "#/domains/") {
+				refName = exportedName(g.domainId) + refName
+			}
+			refName = g.uniqueName(refName)
+			g.refs[refPath] = refName
+			g.define(refName, resolved, refPath)
+		}
+		return refName
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		if _, ok := schema["properties"].(map[string]interface{}); ok {
+			nested := g.uniqueName(name)
+			g.define(nested, schema, path)
+			return nested
+		}
+		if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			return "map[string]" + g.goType(additional, name+"Value", path+"/additionalProperties")
+		}
+		return "map[string]interface{}"
+	case "array":
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			return "[]" + g.goType(items, name+"Item", path+"/items")
+		}
+		return "[]interface{}"
+	case "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "json.Number"
+	case "boolean":
+		return "bool"
+	}
+	return "interface{}"
+}
+
+func (g *codeGenerator) structType(name string, schema map[string]interface{}, path string) string {
+	props, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, r := range list {
+			if key, ok := r.(string); ok {
+				required[key] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	fields := make(map[string]bool)
+	for _, key := range sortedKeys(props) {
+		propSchema, _ := props[key].(map[string]interface{})
+		field := exportedName(key)
+		for i := 2; fields[field]; i++ {
+			field = fmt.Sprintf("%s%d", exportedName(key), i)
+		}
+		fields[field] = true
+
+		fieldType := g.goType(propSchema, name+exportedName(key), path+"/properties/"+escapePointer(key))
+		tag := key
+		if !required[key] {
+			tag += ",omitempty"
+			if !omittable(fieldType) {
+				fieldType = "*" + fieldType
+			}
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", field, fieldType, tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// omittable reports whether zero value of Go type is omitted by omitempty,
+// other optional fields become pointers so zero values are not sent.
+func omittable(goType string) bool {
+	switch {
+	case goType == "string", goType == "json.Number", goType == "interface{}":
+		return true
+	case strings.HasPrefix(goType, "[]"), strings.HasPrefix(goType, "map["):
+		return true
+	}
+	return false
+}
+
+// schemaType returns the only non-null type of schema, enum of strings is a string.
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				types = append(types, s)
+			}
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		return ""
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		for _, e := range enum {
+			if _, isString := e.(string); !isString {
+				return ""
+			}
+		}
+		return "string"
+	}
+	return ""
+}
+
+// exportedName converts key (e.g. "finalPriceConsent", "seat-map") into exported Go identifier ("FinalPriceConsent", "SeatMap").
+func exportedName(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	name := b.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,198 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const codegenSchema = `{
+	"domains": {
+		"Flight": {
+			"inputs": {
+				"finalPriceConsent": {"sourceOutputKey": "finalPrice", "inputMethod": "Consent", "typeRef": "Price"},
+				"passengers": {"schema": {"type": "array", "items": {"typeRef": "Passenger"}}},
+				"seat-map": {"type": "object", "additionalProperties": {"type": "integer"}},
+				"notes": {"description": "no schema"}
+			},
+			"outputs": {
+				"finalPrice": {"typeRef": "Price"},
+				"availableSeats": {"type": "array", "items": {"type": "object", "required": ["id"], "properties": {"id": {"type": "string"}, "free": {"type": "boolean"}}}}
+			},
+			"types": {
+				"Passenger": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "cabin": {"enum": ["economy", "business"]}, "address": {"type": "object", "properties": {"line1": {"type": "string"}}}}}
+			}
+		},
+		"Hotel": {
+			"inputs": {
+				"roomPrice": {"typeRef": "Price"},
+				"guests": {"schema": {"type": "array", "items": {"typeRef": "Passenger"}}}
+			},
+			"types": {
+				"Passenger": {"type": "object", "properties": {"room": {"type": "string"}}}
+			}
+		}
+	},
+	"types": {
+		"Price": {"type": "object", "required": ["value", "currencyCode"], "properties": {"value": {"type": "number"}, "currencyCode": {"type": "string"}}}
+	}
+}`
+
+func TestGenerateCode(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(codegenSchema), &schema)
+
+	src, err := GenerateCode(schema, "protocol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	expected := []string{
+		"package protocol",
+		"\"encoding/json\"",
+		"func (r Runner) Flight() FlightDomain {",
+		"func (d FlightDomain) AnswerFinalPriceConsent(data FlightFinalPriceConsentInput) error {\n\treturn d.SendInput(\"finalPriceConsent\", data)",
+		"func (d FlightDomain) AnswerSeatMap(data FlightSeatMapInput) error {",
+		"func (d FlightDomain) OutputFinalPrice() (data FlightFinalPriceOutput, err error) {\n\terr = d.DecodeOutput(\"finalPrice\", &data)",
+		"// Price is generated from #/types/Price.",
+		"type FlightFinalPriceConsentInput Price",
+		"type HotelRoomPriceInput Price",
+		"type HotelGuestsInput []HotelPassenger",
+		"CurrencyCode string      `json:\"currencyCode\"`\n\tValue        json.Number `json:\"value\"`",
+		"Address *FlightPassengerAddress `json:\"address,omitempty\"`",
+		"Age     *int64                  `json:\"age,omitempty\"`",
+		"Cabin   string                  `json:\"cabin,omitempty\"`",
+		"type FlightPassengersInput []FlightPassenger",
+		"type FlightSeatMapInput map[string]int64",
+		"// FlightNotesInput is generated from #/domains/Flight/inputs/notes.\ntype FlightNotesInput interface{}",
+		"type FlightAvailableSeatsOutput []FlightAvailableSeatsOutputItem",
+		"Free *bool  `json:\"free,omitempty\"`",
+	}
+	for _, e := range expected {
+		if !strings.Contains(code, e) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", e, code)
+		}
+	}
+	if strings.Count(code, "type Price ") != 1 {
+		t.Errorf("expected referenced type to be generated once, got:\n%s", code)
+	}
+
+	t.Run("compiles", func(t *testing.T) {
+		if _, err := exec.LookPath("go"); err != nil {
+			t.Skip("go command is not available")
+		}
+		// package is placed inside the module, so it imports job runner being tested
+		dir, err := ioutil.TempDir(".", "_codegen")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "protocol.go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if out, err := exec.Command("go", "build", "./"+dir).CombinedOutput(); err != nil {
+			t.Errorf("expected generated code to compile, got %v:\n%s\n%s", err, out, code)
+		}
+	})
+
+	t.Run("exported names", func(t *testing.T) {
+		cases := map[string]string{"finalPriceConsent": "FinalPriceConsent", "seat-map": "SeatMap", "3ds": "X3ds", "": "X"}
+		for key, name := range cases {
+			if actual := exportedName(key); actual != name {
+				t.Errorf("expected %q to become %s, got %s", key, name, actual)
+			}
+		}
+	})
+}
+
+func TestTypedHelpers(t *testing.T) {
+	var sent []string
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://protocol/schema.json":
+			body = codegenSchema
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "finalPriceConsent", "awaitingInputStage": "2"}`
+		case "GET http://api/jobs/job-id/outputs/finalPrice":
+			body = `{"key": "finalPrice", "data": {"value": 1234567890123.10, "currencyCode": "gbp"}}`
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	type price struct {
+		Value        json.Number `json:"value"`
+		CurrencyCode string      `json:"currencyCode"`
+	}
+
+	t.Run("decode output", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "Flight")
+		var p price
+		if err := jr.DecodeOutput("finalPrice", &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Value != "1234567890123.10" || p.CurrencyCode != "gbp" {
+			t.Errorf("expected exact price, got %v", p)
+		}
+	})
+
+	t.Run("send input", func(t *testing.T) {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.WithProtocolUrl("http://protocol")
+		jr.ResumeJob("job-id", "Flight")
+		if err := jr.SendInput("finalPriceConsent", price{Value: "12.30", CurrencyCode: "gbp"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := jr.SendInput("notes", "window seat"); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			`{"data":{"value":12.30,"currencyCode":"gbp"},"key":"finalPriceConsent","stage":"2"}`,
+			`{"data":"window seat","key":"notes"}`,
+		}
+		if len(sent) != 2 || sent[0] != expected[0] || sent[1] != expected[1] {
+			t.Errorf("expected inputs %v, got %v", expected, sent)
+		}
+		if jr.Timeline()[0].Type != EventInputSent {
+			t.Errorf("expected input to be recorded, got %v", jr.Timeline())
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.WithProtocolUrl("http://protocol")
+		jr.ResumeJob("job-id", "Flight")
+		jr.JobRun.ValidateInputs = ValidationFail
+		err := jr.SendInput("finalPriceConsent", map[string]interface{}{"value": "12.30"})
+		if _, ok := err.(SchemaError); !ok || len(sent) != 0 {
+			t.Errorf("expected schema error without input sent, got %v, %v", err, sent)
+		}
+	})
+
+	t.Run("no job", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		err := jr.SendInput("notes", "")
+		expectError(t, "job runner is not ready to send input: no job created or resumed", err)
+	})
+}
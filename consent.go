@@ -0,0 +1,156 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// EventInputDeclined is recorded when runner refuses to consent to job output, job gets canceled afterwards.
+const EventInputDeclined = "inputDeclined"
+
+// ConsentPolicy decides whether runner consents to price-like outputs it echoes back for Consent inputs,
+// e.g. "finalPriceConsent" sent from "finalPrice". Runner consents to anything when JobRun.Consent is nil.
+type ConsentPolicy struct {
+	// MaxAmount is the highest price runner consents to by currency code, e.g. {"GBP": "500"}.
+	// Prices in currencies not listed are declined unless MaxAmount is empty.
+	MaxAmount map[string]json.Number `json:"maxAmount,omitempty"`
+	// QuoteOutputKey is an output holding price quoted earlier in the job, e.g. "estimatedPrice",
+	// price differing from it by more than MaxDeviation percent is declined.
+	QuoteOutputKey string  `json:"quoteOutputKey,omitempty"`
+	MaxDeviation   float64 `json:"maxDeviation,omitempty"`
+	// Decline refuses every consent, used to exercise decline path of a service.
+	// Canceled job then passes, see RunResult.Passed.
+	Decline bool `json:"decline,omitempty"`
+}
+
+// ConsentError is returned by CreateInput when consent is declined by JobRun.Consent policy.
+type ConsentError struct {
+	JobId  string
+	Key    string
+	Reason string
+}
+
+// Error makes string representation of a consent error.
+func (e ConsentError) Error() string {
+	return fmt.Sprintf("consent %s declined for job %s: %s", e.Key, e.JobId, e.Reason)
+}
+
+// check returns reason to decline consent to given price-like data, empty when price is acceptable.
+// quote loads price quoted earlier, it is called only when QuoteOutputKey is set.
+func (p *ConsentPolicy) check(data interface{}, quote func(key string) (interface{}, error)) string {
+	if p == nil {
+		return ""
+	}
+	if p.Decline {
+		return "policy declines every consent"
+	}
+	if len(p.MaxAmount) == 0 && p.QuoteOutputKey == "" {
+		return ""
+	}
+
+	price, err := ParsePrice(data)
+	if err != nil {
+		return err.Error()
+	}
+
+	if len(p.MaxAmount) > 0 {
+		max, ok := p.maxAmount(price.CurrencyCode)
+		if !ok {
+			return "no maximum amount for currency " + formatCurrency(price.CurrencyCode)
+		}
+		if price.Value.Cmp(max) > 0 {
+			return fmt.Sprintf("price %s exceeds maximum %s", price, Price{max, price.CurrencyCode})
+		}
+	}
+
+	if p.QuoteOutputKey != "" {
+		quoted, err := quote(p.QuoteOutputKey)
+		if err != nil {
+			return "unable to load quoted price " + p.QuoteOutputKey + ": " + err.Error()
+		}
+		quotedPrice, err := ParsePrice(quoted)
+		if err != nil {
+			return "quoted price " + p.QuoteOutputKey + " is invalid: " + err.Error()
+		}
+		if !strings.EqualFold(price.CurrencyCode, quotedPrice.CurrencyCode) {
+			return fmt.Sprintf("price %s is in other currency than quoted %s", price, quotedPrice)
+		}
+		if deviation, ok := deviation(price.Value, quotedPrice.Value); !ok || deviation > p.MaxDeviation {
+			return fmt.Sprintf("price %s differs from quoted %s by more than %g%%", price, quotedPrice, p.MaxDeviation)
+		}
+	}
+	return ""
+}
+
+// maxAmount finds maximum amount of currency, codes are compared case-insensitively.
+func (p *ConsentPolicy) maxAmount(currencyCode string) (*big.Rat, bool) {
+	for code, amount := range p.MaxAmount {
+		if strings.EqualFold(code, currencyCode) {
+			return toRat(amount)
+		}
+	}
+	return nil, false
+}
+
+// deviation returns how much value differs from quoted one in percent, false when quote is zero and value is not.
+func deviation(value, quoted *big.Rat) (float64, bool) {
+	diff := new(big.Rat).Sub(value, quoted)
+	if diff.Sign() == 0 {
+		return 0, true
+	}
+	if quoted.Sign() == 0 {
+		return 0, false
+	}
+	diff.Abs(diff).Quo(diff, new(big.Rat).Abs(quoted)).Mul(diff, big.NewRat(100, 1))
+	percent, _ := diff.Float64()
+	return percent, true
+}
+
+func formatCurrency(code string) string {
+	if code == "" {
+		return "(none)"
+	}
+	return strings.ToUpper(code)
+}
+
+// checkConsent applies JobRun.Consent policy to data answering awaited input of current job when protocol defines
+// it as Consent input, whatever source data comes from: output, mapping, stash, resolvers or a resent answer.
+func (jr *JobRunner) checkConsent(data interface{}) error {
+	if jr.JobRun.Consent == nil {
+		return nil
+	}
+	prot, err := jr.apiClient.GetProtocol()
+	if err != nil {
+		return err
+	}
+	if prot.Domains[jr.DomainId].Inputs[jr.Job.AwaitingInputKey].InputMethod != "Consent" {
+		return nil
+	}
+
+	reason := jr.JobRun.Consent.check(data, jr.fetchOutput)
+	if reason == "" {
+		return nil
+	}
+	return ConsentError{jr.Job.Id, jr.Job.AwaitingInputKey, reason}
+}
+
+// decline records declined consent and cancels current job, so service exercises its decline path.
+func (jr *JobRunner) decline(err ConsentError, data interface{}) error {
+	jr.record(Event{Type: EventInputDeclined, Key: err.Key, Data: data, Message: err.Reason})
+	if cancelErr := jr.cancelJob(jr.Job, "consent "+err.Key+" declined"); cancelErr != nil {
+		return cancelErr
+	}
+	return err
+}
+
+// declinedInputs describes consents declined by runner, e.g. "finalPriceConsent: price 600.00 GBP exceeds maximum 500.00 GBP".
+func declinedInputs(events []Event) (declined []string) {
+	for _, e := range events {
+		if e.Type == EventInputDeclined {
+			declined = append(declined, e.Key+": "+e.Message)
+		}
+	}
+	return
+}
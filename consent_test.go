@@ -0,0 +1,172 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestConsentPolicy(t *testing.T) {
+	var sent []string
+	canceled := false
+	finalPrice := `{"value": 600.00, "currencyCode": "gbp"}`
+	awaitingKey := "finalPriceConsent"
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		status := 200
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			state := "awaitingInput"
+			if canceled {
+				state = "canceled"
+			}
+			body = `{"id": "job-id", "state": "` + state + `", "awaitingInputKey": "` + awaitingKey + `"}`
+		case "GET http://api/jobs/job-id/outputs/finalPrice":
+			body = `{"key": "finalPrice", "data": ` + finalPrice + `}`
+		case "GET http://api/jobs/job-id/outputs/estimatedPrice":
+			body = `{"key": "estimatedPrice", "data": {"value": 550, "currencyCode": "GBP"}}`
+		case "GET https://protocol.automationcloud.net/schema.json":
+			body = `{"domains": {"Flight": {"inputs": {
+				"finalPriceConsent": {"sourceOutputKey": "finalPrice", "inputMethod": "Consent"},
+				"upgradeConsent": {"inputMethod": "Consent"}
+			}}}}`
+		case "GET http://api/jobs/job-id/outputs":
+			body = `{"data": []}`
+		case "GET http://api/jobs/job-id/outputs/missingPrice":
+			status = 404
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		case "POST http://api/jobs/job-id/cancel":
+			canceled = true
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	run := func(policy *ConsentPolicy) (*JobRunner, error) {
+		sent, canceled = nil, false
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Consent = policy
+		jr.ResumeJob("job-id", "Flight")
+		return &jr, jr.CreateInput()
+	}
+
+	t.Run("consents without policy", func(t *testing.T) {
+		if _, err := run(nil); err != nil || len(sent) != 1 || canceled {
+			t.Errorf("expected consent to be sent, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("consents within limits", func(t *testing.T) {
+		_, err := run(&ConsentPolicy{
+			MaxAmount:      map[string]json.Number{"GBP": "600", "EUR": "700"},
+			QuoteOutputKey: "estimatedPrice",
+			MaxDeviation:   10,
+		})
+		if err != nil || len(sent) != 1 || canceled {
+			t.Errorf("expected consent to be sent, got %v, %v", sent, err)
+		}
+	})
+
+	cases := []struct {
+		name   string
+		policy *ConsentPolicy
+		reason string
+	}{
+		{"always decline", &ConsentPolicy{Decline: true}, "policy declines every consent"},
+		{"maximum exceeded", &ConsentPolicy{MaxAmount: map[string]json.Number{"gbp": "599.99"}}, "price 600.00 GBP exceeds maximum 599.99 GBP"},
+		{"unknown currency", &ConsentPolicy{MaxAmount: map[string]json.Number{"EUR": "1000"}}, "no maximum amount for currency GBP"},
+		{"quote deviation", &ConsentPolicy{QuoteOutputKey: "estimatedPrice", MaxDeviation: 5}, "price 600.00 GBP differs from quoted 550.00 GBP by more than 5%"},
+		{"missing quote", &ConsentPolicy{QuoteOutputKey: "missingPrice"}, "unable to load quoted price missingPrice: client error"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			jr, err := run(c.policy)
+			expectError(t, "consent finalPriceConsent declined for job job-id: "+c.reason, err)
+			if len(sent) != 0 || !canceled {
+				t.Errorf("expected job to be canceled without consent, got %v", sent)
+			}
+			if e := jr.Events[0]; e.Type != EventInputDeclined || e.Message != c.reason || toJSON(e.Data) != `{"currencyCode":"gbp","value":600.00}` {
+				t.Errorf("expected decline to be recorded, got %v", e)
+			}
+			if e := jr.Events[1]; e.Type != EventJobCanceled || e.Message != "consent finalPriceConsent declined" {
+				t.Errorf("expected cancellation to be recorded, got %v", e)
+			}
+		})
+	}
+
+	t.Run("invalid price", func(t *testing.T) {
+		finalPrice = `{"value": "free", "currencyCode": "gbp"}`
+		defer func() { finalPrice = `{"value": 600.00, "currencyCode": "gbp"}` }()
+		_, err := run(&ConsentPolicy{MaxAmount: map[string]json.Number{"GBP": "1"}})
+		expectError(t, `consent finalPriceConsent declined for job job-id: invalid price value: expected decimal, got "free"`, err)
+	})
+
+	t.Run("stashed consent", func(t *testing.T) {
+		sent, canceled = nil, false
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Consent = &ConsentPolicy{MaxAmount: map[string]json.Number{"GBP": "500"}}
+		jr.ResumeJob("job-id", "Flight")
+		jr.InputData = map[string]interface{}{"finalPriceConsent": map[string]interface{}{"value": 550, "currencyCode": "GBP"}}
+		err := jr.CreateInput()
+		expectError(t, "consent finalPriceConsent declined for job job-id: price 550.00 GBP exceeds maximum 500.00 GBP", err)
+		if len(sent) != 0 || !canceled {
+			t.Errorf("expected job to be canceled without consent, got %v", sent)
+		}
+	})
+
+	t.Run("resolved consent", func(t *testing.T) {
+		awaitingKey = "upgradeConsent"
+		defer func() { awaitingKey = "finalPriceConsent" }()
+		sent, canceled = nil, false
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Consent = &ConsentPolicy{MaxAmount: map[string]json.Number{"GBP": "500"}}
+		jr.Resolvers = []InputResolver{func(req InputRequest) (interface{}, error) {
+			return map[string]interface{}{"value": 120, "currencyCode": "EUR"}, nil
+		}}
+		jr.ResumeJob("job-id", "Flight")
+		err := jr.CreateInput()
+		expectError(t, "consent upgradeConsent declined for job job-id: no maximum amount for currency EUR", err)
+		if len(sent) != 0 || !canceled {
+			t.Errorf("expected job to be canceled without consent, got %v", sent)
+		}
+	})
+
+	t.Run("requested decline passes", func(t *testing.T) {
+		jr, _ := run(&ConsentPolicy{Decline: true})
+		result, err := jr.CollectResult()
+		if err != nil || !result.DeclineExpected || !result.Passed() {
+			t.Errorf("expected canceled job to pass, got %v, %v", result, err)
+		}
+
+		jr, _ = run(&ConsentPolicy{MaxAmount: map[string]json.Number{"GBP": "500"}})
+		if result, err = jr.CollectResult(); err != nil || result.Passed() {
+			t.Errorf("expected job canceled by limits to fail, got %v, %v", result, err)
+		}
+
+		if (RunResult{State: "success", DeclineExpected: true}).Passed() {
+			t.Errorf("expected job without declined consent to fail")
+		}
+	})
+
+	t.Run("declines are reported", func(t *testing.T) {
+		events := []Event{
+			{Type: EventInputDeclined, Key: "finalPriceConsent", Message: "policy declines every consent"},
+			{Type: EventJobCanceled, Message: "consent finalPriceConsent declined"},
+		}
+		declined := declinedInputs(events)
+		if len(declined) != 1 || declined[0] != "finalPriceConsent: policy declines every consent" {
+			t.Errorf("expected declined consent to be listed, got %v", declined)
+		}
+	})
+}
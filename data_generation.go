@@ -46,7 +46,7 @@ func GenerateData(jibUrl string, config JibConfig, client *http.Client) (data ma
 		return
 	}
 
-	err = json.Unmarshal(body, &data)
+	err = decodeJSON(body, &data)
 	if err != nil {
 		return
 	}
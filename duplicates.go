@@ -0,0 +1,109 @@
+package jobrunner
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EventInputDuplicate is recorded when job awaits input which was already sent and it is not sent again.
+const EventInputDuplicate = "inputDuplicate"
+
+// DuplicateInputPolicy decides what CreateInput does when job awaits input (same key and stage)
+// which runner has already sent, e.g. when webhook is retried or polling races with webhook.
+type DuplicateInputPolicy string
+
+// Duplicate input policies, DuplicateInputSkip is the default one.
+const (
+	// DuplicateInputSkip does not send input again and reports no error.
+	DuplicateInputSkip DuplicateInputPolicy = "skip"
+	// DuplicateInputResend sends the same data again.
+	DuplicateInputResend DuplicateInputPolicy = "resend"
+	// DuplicateInputRegenerate sends fresh data: generated by jib for stashed inputs or derived from current outputs.
+	DuplicateInputRegenerate DuplicateInputPolicy = "regenerate"
+	// DuplicateInputFail does not send input and reports DuplicateInputError.
+	DuplicateInputFail DuplicateInputPolicy = "fail"
+)
+
+// DuplicateInputError is returned by CreateInput when input was already sent and JobRun.DuplicateInputs is DuplicateInputFail.
+type DuplicateInputError struct {
+	JobId string
+	Key   string
+	Stage string
+}
+
+// Error makes string representation of a duplicate input error.
+func (e DuplicateInputError) Error() string {
+	key := e.Key
+	if e.Stage != "" {
+		key += " (stage " + e.Stage + ")"
+	}
+	return fmt.Sprintf("input %s was already sent to job %s", key, e.JobId)
+}
+
+var errSkipInput = errors.New("input already sent")
+
+func answeredInputKey(key, stage string) string {
+	return key + "\x00" + stage
+}
+
+// answeredInput returns data previously sent for input current job awaits.
+func (jr *JobRunner) answeredInput() (data interface{}, ok bool) {
+	state := jr.observe(jr.Job)
+	data, ok = state.answered[answeredInputKey(jr.Job.AwaitingInputKey, jr.Job.AwaitingInputStage)]
+	return
+}
+
+// markAnswered remembers data sent for input current job awaits.
+func (jr *JobRunner) markAnswered(data interface{}) {
+	state := jr.observe(jr.Job)
+	if state.answered == nil {
+		state.answered = make(map[string]interface{})
+	}
+	state.answered[answeredInputKey(jr.Job.AwaitingInputKey, jr.Job.AwaitingInputStage)] = data
+}
+
+// duplicateInput applies JobRun.DuplicateInputs policy to input which was already sent,
+// errSkipInput is returned when input should not be sent.
+func (jr *JobRunner) duplicateInput(previous interface{}) (data interface{}, err error) {
+	switch jr.JobRun.DuplicateInputs {
+	case DuplicateInputResend:
+		return previous, nil
+	case DuplicateInputRegenerate:
+		return jr.regenerateInput()
+	case DuplicateInputFail:
+		return nil, DuplicateInputError{jr.Job.Id, jr.Job.AwaitingInputKey, jr.Job.AwaitingInputStage}
+	}
+	return nil, errSkipInput
+}
+
+// regenerateInput generates new data for stashed input or derives it again from job outputs.
+func (jr *JobRunner) regenerateInput() (data interface{}, err error) {
+	key := jr.Job.AwaitingInputKey
+	stash := jr.stash()
+	if _, stashed := stash[key]; !stashed {
+		return jr.deriveInput()
+	}
+
+	jobIndex := 0
+	if state, ok := jr.states[jr.Job.Id]; ok {
+		jobIndex = state.jobIndex
+	}
+	generated, err := jr.generateData(jr.JobRun, jobIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := generated[key]
+	if !ok {
+		return nil, errors.New("regenerated data does not contain input " + key)
+	}
+
+	// stash may be shared with other jobs or be jr.InputData, so job gets a copy of its own
+	own := make(map[string]interface{}, len(stash))
+	for k, v := range stash {
+		own[k] = v
+	}
+	own[key] = data
+	jr.observe(jr.Job).inputData = own
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestDuplicateInputs(t *testing.T) {
+	var sent []string
+	generated := 0
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		case "POST http://jib":
+			generated++
+			body = `{"passengers": "regenerated"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	run := func(policy DuplicateInputPolicy) (*JobRunner, error) {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.DuplicateInputs = policy
+		jr.InputData = map[string]interface{}{"passengers": "stashed"}
+		jr.ResumeJob("job-id", "A")
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		return &jr, jr.CreateInput()
+	}
+
+	t.Run("skip by default", func(t *testing.T) {
+		jr, err := run("")
+		if err != nil || len(sent) != 1 {
+			t.Errorf("expected input to be sent once, got %v, %v", sent, err)
+		}
+		if e := jr.Events[1]; e.Type != EventInputDuplicate || e.Message != "skipped: input already sent" {
+			t.Errorf("expected skipped duplicate to be recorded, got %v", e)
+		}
+	})
+
+	t.Run("resend", func(t *testing.T) {
+		_, err := run(DuplicateInputResend)
+		if err != nil || len(sent) != 2 || sent[0] != sent[1] {
+			t.Errorf("expected input to be sent twice, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		jr, err := run(DuplicateInputRegenerate)
+		if err != nil || len(sent) != 2 || sent[1] != `{"key":"passengers","data":"regenerated"}` {
+			t.Errorf("expected regenerated input to be sent, got %v, %v", sent, err)
+		}
+		if generated != 1 || jr.stash()["passengers"] != "regenerated" {
+			t.Errorf("expected stashed data to be regenerated, got %v", jr.stash())
+		}
+		if jr.InputData["passengers"] != "stashed" {
+			t.Errorf("expected shared input data to stay intact, got %v", jr.InputData)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := run(DuplicateInputFail)
+		expectError(t, "input passengers was already sent to job job-id", err)
+		if len(sent) != 1 {
+			t.Errorf("expected input to be sent once, got %v", sent)
+		}
+	})
+}
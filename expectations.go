@@ -0,0 +1,335 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// Expectation describes assertion about job output, options are:
+// - OutputKey: key of output to check, required
+// - Path: dot-separated path inside of output data (e.g. "price.value" or "fares.0.id"), optional
+// - Equals: expected value, compared as json, null is expected when EqualsSet is true (json with "equals": null sets it)
+// - Matches: regular expression value must match, non-string values are matched against their json
+// - Min, Max: allowed numeric range (inclusive)
+// - Schema: JSON Schema value must be valid against
+// - Snapshot: path to a json file containing expected value
+// Output (and path, when specified) must exist for any expectation to pass.
+type Expectation struct {
+	OutputKey string                 `json:"outputKey"`
+	Path      string                 `json:"path,omitempty"`
+	Equals    interface{}            `json:"equals,omitempty"`
+	EqualsSet bool                   `json:"-"`
+	Matches   string                 `json:"matches,omitempty"`
+	Min       *float64               `json:"min,omitempty"`
+	Max       *float64               `json:"max,omitempty"`
+	Schema    map[string]interface{} `json:"schema,omitempty"`
+	Snapshot  string                 `json:"snapshot,omitempty"`
+}
+
+// expectationFields is Expectation without custom json encoding.
+type expectationFields Expectation
+
+// UnmarshalJSON decodes expectation keeping numbers exact, EqualsSet tells whether "equals" is present.
+func (e *Expectation) UnmarshalJSON(b []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	if err := decodeJSON(b, (*expectationFields)(e)); err != nil {
+		return err
+	}
+	_, e.EqualsSet = keys["equals"]
+	return nil
+}
+
+// MarshalJSON encodes expectation, "equals" is kept when it is set to null.
+func (e Expectation) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(expectationFields(e))
+	if err != nil || !e.EqualsSet || e.Equals != nil {
+		return b, err
+	}
+	return append(b[:len(b)-1], `,"equals":null}`...), nil
+}
+
+// AssertionResult is an outcome of a single check.
+// Check is one of "exists", "equals", "matches", "range", "schema", "snapshot",
+// Diff explains the failure.
+type AssertionResult struct {
+	OutputKey string `json:"outputKey"`
+	Path      string `json:"path,omitempty"`
+	Check     string `json:"check"`
+	Passed    bool   `json:"passed"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// AllPassed reports whether every assertion result passed.
+func AllPassed(results []AssertionResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckExpectations evaluates jr.Expectations against outputs of current job.
+// Failed expectations do not produce an error, they are reported as results with Passed set to false.
+// Error is returned when outputs could not be loaded.
+func (jr *JobRunner) CheckExpectations() (results []AssertionResult, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return jr.checkExpectations()
+}
+
+func (jr *JobRunner) checkExpectations() (results []AssertionResult, err error) {
+	if jr.Job == nil {
+		return nil, errors.New("job runner is not ready to check expectations: no job created or resumed")
+	}
+
+	for _, e := range jr.Expectations {
+		output, err := jr.fetchOutput(e.OutputKey)
+		if err == cl.ErrClient {
+			results = append(results, AssertionResult{
+				OutputKey: e.OutputKey,
+				Path:      e.Path,
+				Check:     "exists",
+				Diff:      "output " + e.OutputKey + " not found",
+			})
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, jr.redactDiffs(e, output, e.Check(output))...)
+	}
+
+	return results, nil
+}
+
+// redactDiffs replaces diffs of failed checks with ones produced against redacted output,
+// so sensitive values do not leak into reports.
+func (jr *JobRunner) redactDiffs(e Expectation, data interface{}, results []AssertionResult) []AssertionResult {
+	if jr.Redactor == nil {
+		return results
+	}
+
+	redacted := jr.Redactor.RedactKey(e.OutputKey, data)
+	if jsonEqual(redacted, data) {
+		return results
+	}
+
+	redactedResults := e.Check(redacted)
+	for i := range results {
+		if !results[i].Passed && i < len(redactedResults) {
+			results[i].Diff = redactedResults[i].Diff
+		}
+	}
+	return results
+}
+
+// Check evaluates expectation against output data.
+func (e Expectation) Check(data interface{}) (results []AssertionResult) {
+	result := func(check string, diff string) {
+		results = append(results, AssertionResult{
+			OutputKey: e.OutputKey,
+			Path:      e.Path,
+			Check:     check,
+			Passed:    diff == "",
+			Diff:      diff,
+		})
+	}
+
+	value, found := lookupPath(data, e.Path)
+	if !found {
+		result("exists", "path "+e.Path+" not found in output "+e.OutputKey)
+		return
+	}
+
+	checked := false
+	if e.Equals != nil || e.EqualsSet {
+		checked = true
+		result("equals", strings.Join(diffValues("", e.Equals, value), "\n"))
+	}
+
+	if e.Matches != "" {
+		checked = true
+		result("matches", matchDiff(e.Matches, value))
+	}
+
+	if e.Min != nil || e.Max != nil {
+		checked = true
+		result("range", rangeDiff(e.Min, e.Max, value))
+	}
+
+	if e.Schema != nil {
+		checked = true
+		var diff []string
+		for _, v := range ValidateSchema(e.Schema, normalizeJSON(value)) {
+			diff = append(diff, v.String())
+		}
+		result("schema", strings.Join(diff, "\n"))
+	}
+
+	if e.Snapshot != "" {
+		checked = true
+		result("snapshot", snapshotFileDiff(e.Snapshot, value))
+	}
+
+	if !checked {
+		result("exists", "")
+	}
+
+	return
+}
+
+func matchDiff(pattern string, value interface{}) string {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "invalid pattern: " + err.Error()
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		s = toJSON(value)
+	}
+
+	if !re.MatchString(s) {
+		return fmt.Sprintf("%q does not match %q", s, pattern)
+	}
+	return ""
+}
+
+func rangeDiff(min, max *float64, value interface{}) string {
+	n, ok := toFloat(value)
+	if !ok || !isNumber(value) {
+		return "expected number, got " + toJSON(value)
+	}
+
+	if min != nil && n < *min {
+		return fmt.Sprintf("expected >= %v, got %v", *min, n)
+	}
+
+	if max != nil && n > *max {
+		return fmt.Sprintf("expected <= %v, got %v", *max, n)
+	}
+	return ""
+}
+
+func snapshotFileDiff(filename string, value interface{}) string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "unable to read snapshot: " + err.Error()
+	}
+
+	var expected interface{}
+	if err := decodeJSON(b, &expected); err != nil {
+		return "invalid snapshot " + filename + ": " + err.Error()
+	}
+
+	return strings.Join(diffValues("", expected, value), "\n")
+}
+
+// lookupPath finds value by dot-separated path, numeric segments index arrays.
+// Empty path refers to data itself.
+func lookupPath(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+
+	current := normalizeJSON(data)
+	for _, segment := range strings.Split(path, ".") {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, ok := c[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// diffValues compares expected and actual values as json and lists differences
+// as lines in "path: expected X, got Y" format.
+func diffValues(path string, expected, actual interface{}) (diff []string) {
+	return diffNormalized(path, normalizeJSON(expected), normalizeJSON(actual))
+}
+
+func diffNormalized(path string, expected, actual interface{}) (diff []string) {
+	label := path
+	if label == "" {
+		label = "."
+	}
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(e)+len(a))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ev, eok := e[k]
+			av, aok := a[k]
+			switch {
+			case !aok:
+				diff = append(diff, joinPath(path, k)+": missing, expected "+toJSON(ev))
+			case !eok:
+				diff = append(diff, joinPath(path, k)+": unexpected "+toJSON(av))
+			default:
+				diff = append(diff, diffNormalized(joinPath(path, k), ev, av)...)
+			}
+		}
+		return
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(e) != len(a) {
+			return append(diff, fmt.Sprintf("%s: expected %d items, got %d", label, len(e), len(a)))
+		}
+		for i := range e {
+			diff = append(diff, diffNormalized(joinPath(path, strconv.Itoa(i)), e[i], a[i])...)
+		}
+		return
+	}
+
+	if !jsonEqual(expected, actual) {
+		diff = append(diff, label+": expected "+toJSON(expected)+", got "+toJSON(actual))
+	}
+	return
+}
+
+func joinPath(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
@@ -0,0 +1,162 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExpectations(t *testing.T) {
+	client := newTestClient(func(req *http.Request) *http.Response {
+		status := 200
+		var body string
+		switch req.URL.String() {
+		case "http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "success"}`
+		case "http://api/jobs/job-id/outputs/finalPrice":
+			body = `{"data": {"value": 13.5, "currencyCode": "gbp"}}`
+		default:
+			status = 404
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	min, max := 10.0, 20.0
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	err := jr.ResumeJob("job-id", "A")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	jr.Expectations = []Expectation{
+		{OutputKey: "finalPrice", Path: "value", Min: &min, Max: &max},
+		{OutputKey: "finalPrice", Path: "currencyCode", Equals: "eur"},
+		{OutputKey: "bookingReference"},
+	}
+
+	results, err := jr.CheckExpectations()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	expected := []AssertionResult{
+		{OutputKey: "finalPrice", Path: "value", Check: "range", Passed: true},
+		{OutputKey: "finalPrice", Path: "currencyCode", Check: "equals", Diff: `.: expected "eur", got "gbp"`},
+		{OutputKey: "bookingReference", Check: "exists", Diff: "output bookingReference not found"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("expected result %v, got %v", expected[i], results[i])
+		}
+	}
+
+	if AllPassed(results) {
+		t.Error("expected some assertions to fail")
+	}
+}
+
+func TestExpectationCheck(t *testing.T) {
+	output := map[string]interface{}{
+		"fares": []interface{}{
+			map[string]interface{}{"id": "f1", "cabin": "economy", "price": 10},
+		},
+	}
+
+	t.Run("equals with diff", func(t *testing.T) {
+		e := Expectation{OutputKey: "o", Equals: map[string]interface{}{
+			"fares": []interface{}{
+				map[string]interface{}{"id": "f2", "cabin": "economy"},
+			},
+		}}
+		results := e.Check(output)
+		expectedDiff := "fares.0.id: expected \"f2\", got \"f1\"\nfares.0.price: unexpected 10"
+		if results[0].Passed || results[0].Diff != expectedDiff {
+			t.Errorf("expected diff %q, got %q", expectedDiff, results[0].Diff)
+		}
+	})
+
+	t.Run("equals null", func(t *testing.T) {
+		var e Expectation
+		if err := json.Unmarshal([]byte(`{"outputKey": "o", "path": "fares.0.id", "equals": null}`), &e); err != nil {
+			t.Fatal(err)
+		}
+		results := e.Check(output)
+		if len(results) != 1 || results[0].Check != "equals" || results[0].Passed {
+			t.Errorf("expected null to be asserted, got %v", results)
+		}
+		results = e.Check(map[string]interface{}{"fares": []interface{}{map[string]interface{}{"id": nil}}})
+		if !results[0].Passed {
+			t.Errorf("expected null to match, got %v", results[0].Diff)
+		}
+		if b, _ := json.Marshal(e); string(b) != `{"outputKey":"o","path":"fares.0.id","equals":null}` {
+			t.Errorf("expected null expectation to survive encoding, got %s", b)
+		}
+	})
+
+	t.Run("range requires number", func(t *testing.T) {
+		min := 5.0
+		results := Expectation{OutputKey: "o", Path: "fares.0.price", Min: &min}.Check(map[string]interface{}{
+			"fares": []interface{}{map[string]interface{}{"price": "10"}},
+		})
+		if results[0].Passed || results[0].Diff != `expected number, got "10"` {
+			t.Errorf("expected string to fail range check, got %v", results[0])
+		}
+	})
+
+	t.Run("matches", func(t *testing.T) {
+		results := Expectation{OutputKey: "o", Path: "fares.0.id", Matches: "^f[0-9]+$"}.Check(output)
+		if !results[0].Passed {
+			t.Errorf("expected match to pass, got %v", results[0].Diff)
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		results := Expectation{OutputKey: "o", Path: "fares.1.id", Matches: "f"}.Check(output)
+		if len(results) != 1 || results[0].Check != "exists" || results[0].Passed {
+			t.Errorf("expected failed existence check, got %v", results)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		results := Expectation{OutputKey: "o", Path: "fares", Schema: map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"required": []interface{}{"fareId"}},
+		}}.Check(output)
+		expectedDiff := `/0: missing required property "fareId" (schema #/items/required)`
+		if results[0].Passed || results[0].Diff != expectedDiff {
+			t.Errorf("expected diff %q, got %q", expectedDiff, results[0].Diff)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "expectations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "fares.json")
+		ioutil.WriteFile(filename, []byte(`[{"id": "f1", "cabin": "economy", "price": 10}]`), 0644)
+
+		results := Expectation{OutputKey: "o", Path: "fares", Snapshot: filename}.Check(output)
+		if !results[0].Passed {
+			t.Errorf("expected snapshot to match, got %v", results[0].Diff)
+		}
+
+		results = Expectation{OutputKey: "o", Snapshot: filepath.Join(dir, "missing.json")}.Check(output)
+		if results[0].Passed {
+			t.Error("expected missing snapshot to fail")
+		}
+	})
+}
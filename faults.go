@@ -0,0 +1,156 @@
+package jobrunner
+
+import (
+	"errors"
+	"time"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// EventFaultInjected is recorded when runner answers input wrongly on purpose, see JobRun.Faults.
+const EventFaultInjected = "faultInjected"
+
+// FaultType is a way of answering input wrongly.
+type FaultType string
+
+// Fault types, each fault is injected once per job and input key, input is answered as usual afterwards
+// unless job can not continue (FaultDecline) or never gets an answer (FaultNoAnswer).
+const (
+	// FaultDecline cancels job instead of answering, e.g. declines "finalPriceConsent".
+	FaultDecline FaultType = "decline"
+	// FaultInvalid sends data of a different json type than resolved one, so it does not match input schema.
+	FaultInvalid FaultType = "invalid"
+	// FaultWrongKey sends resolved data as another input key, see Fault.Key.
+	FaultWrongKey FaultType = "wrongKey"
+	// FaultDelay holds answer until Fault.Delay passes since job started awaiting input, e.g. beyond service input timeout.
+	FaultDelay FaultType = "delay"
+	// FaultNoAnswer never answers input.
+	FaultNoAnswer FaultType = "noAnswer"
+)
+
+// Fault describes how to answer input key wrongly, options are:
+// - Type: what to do instead of answering correctly, required
+// - Key: input key sent by FaultWrongKey, defaults to awaited key with "Wrong" suffix
+// - Delay: how long FaultDelay holds answer, required for FaultDelay
+// - ExpectErrorCode: error code job is expected to fail with, any error is expected when empty
+type Fault struct {
+	Type            FaultType     `json:"type"`
+	Key             string        `json:"key,omitempty"`
+	Delay           time.Duration `json:"delay,omitempty"`
+	ExpectErrorCode string        `json:"expectErrorCode,omitempty"`
+}
+
+// FaultResult is an outcome of injected fault: error code job finished with and whether it was expected.
+type FaultResult struct {
+	Key             string    `json:"key"`
+	Type            FaultType `json:"type"`
+	ErrorCode       string    `json:"errorCode,omitempty"`
+	ExpectErrorCode string    `json:"expectErrorCode,omitempty"`
+	Passed          bool      `json:"passed"`
+}
+
+// injectFault answers awaited input wrongly according to fault,
+// done is false when input should be answered as usual, e.g. fault was already injected or delay passed.
+func (jr *JobRunner) injectFault(fault Fault) (done bool, err error) {
+	key := jr.Job.AwaitingInputKey
+	state := jr.observe(jr.Job)
+	injected := state.faults[key]
+	if injected && fault.Type != FaultNoAnswer && fault.Type != FaultDelay {
+		return false, nil
+	}
+
+	inject := func(data interface{}, message string) {
+		if state.faults == nil {
+			state.faults = make(map[string]bool)
+		}
+		state.faults[key] = true
+		jr.record(Event{Type: EventFaultInjected, Key: key, Data: data, Message: message})
+	}
+
+	switch fault.Type {
+	case FaultNoAnswer:
+		if !injected {
+			inject(nil, string(fault.Type))
+		}
+		return true, nil
+	case FaultDelay:
+		if fault.Delay <= 0 {
+			return false, errors.New("delay fault of input " + key + " requires delay")
+		}
+		if timeNow().Sub(state.awaitingSince) >= fault.Delay {
+			return false, nil
+		}
+		if !injected {
+			inject(nil, string(fault.Type)+": answer held for "+fault.Delay.String())
+		}
+		return true, nil
+	case FaultDecline:
+		inject(nil, string(fault.Type))
+		return true, jr.cancelJob(jr.Job, "input "+key+" declined by fault injection")
+	case FaultInvalid, FaultWrongKey:
+	default:
+		return false, errors.New("unknown fault type " + string(fault.Type) + " of input " + key)
+	}
+
+	data, err := jr.resolveInput()
+	if err != nil {
+		data = nil
+	}
+
+	sentKey := key
+	message := string(fault.Type)
+	if fault.Type == FaultInvalid {
+		data = invalidData(data)
+	} else {
+		sentKey = fault.Key
+		if sentKey == "" {
+			sentKey = key + "Wrong"
+		}
+		message += ": sent as " + sentKey
+	}
+
+	payload := map[string]interface{}{"key": sentKey, "data": data}
+	if jr.Job.AwaitingInputStage != "" {
+		payload["stage"] = jr.Job.AwaitingInputStage
+	}
+	if err = jr.apiRequest("POST", "/jobs/"+jr.Job.Id+"/inputs", payload, nil); err != nil {
+		if _, rejected := err.(cl.ValidationError); !rejected && err != cl.ErrClient {
+			return true, err
+		}
+		message += ", rejected: " + err.Error()
+	}
+	inject(data, message)
+	return true, nil
+}
+
+// invalidData returns value of a json type other than type of data: objects and arrays become a string, anything else an object.
+func invalidData(data interface{}) interface{} {
+	switch data.(type) {
+	case map[string]interface{}, []interface{}:
+		return "invalid"
+	}
+	return map[string]interface{}{"invalid": true}
+}
+
+// faultResults pairs faults injected into a job with error code it finished with,
+// fault without expected error code passes when job did not succeed.
+func (jr *JobRunner) faultResults(events []Event, state, errorCode string) (results []FaultResult) {
+	for _, e := range events {
+		if e.Type != EventFaultInjected {
+			continue
+		}
+		fault := jr.JobRun.Faults[e.Key]
+		passed := state != "success"
+		if fault.ExpectErrorCode != "" {
+			passed = errorCode == fault.ExpectErrorCode
+		}
+		results = append(results, FaultResult{
+			Key:             e.Key,
+			Type:            fault.Type,
+			ErrorCode:       errorCode,
+			ExpectErrorCode: fault.ExpectErrorCode,
+			Passed:          passed,
+		})
+	}
+	return
+}
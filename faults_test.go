@@ -0,0 +1,142 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFaults(t *testing.T) {
+	var sent []string
+	job := `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers", "awaitingInputStage": "1"}`
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		status := 200
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = job
+		case "GET http://api/jobs/job-id/outputs":
+			body = `{"data": []}`
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+			if bytes.Contains(b, []byte(`"invalid"`)) {
+				status = 400
+				body = `{"details": {"messages": ["data is invalid"]}}`
+			}
+		case "POST http://api/jobs/job-id/cancel":
+			job = `{"id": "job-id", "state": "canceled"}`
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	run := func(fault Fault) *JobRunner {
+		sent = nil
+		job = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers", "awaitingInputStage": "1"}`
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Faults = map[string]Fault{"passengers": fault}
+		jr.InputData = map[string]interface{}{"passengers": []interface{}{"Bob"}}
+		jr.ResumeJob("job-id", "Flight")
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		return &jr
+	}
+
+	t.Run("invalid data", func(t *testing.T) {
+		jr := run(Fault{Type: FaultInvalid})
+		if e := jr.Events[0]; e.Type != EventFaultInjected || e.Message != "invalid, rejected: validation failed: data is invalid" || e.Data != "invalid" {
+			t.Errorf("expected fault to be recorded, got %v", e)
+		}
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			`{"data":"invalid","key":"passengers","stage":"1"}`,
+			`{"key":"passengers","stage":"1","data":["Bob"]}`,
+		}
+		if len(sent) != 2 || sent[0] != expected[0] || sent[1] != expected[1] {
+			t.Errorf("expected invalid data and then correct data to be sent, got %v", sent)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		run(Fault{Type: FaultWrongKey})
+		run(Fault{Type: FaultWrongKey, Key: "seats"})
+		if len(sent) != 1 || sent[0] != `{"data":["Bob"],"key":"seats","stage":"1"}` {
+			t.Errorf("expected data to be sent as other key, got %v", sent)
+		}
+		jr := run(Fault{Type: FaultWrongKey})
+		if sent[0] != `{"data":["Bob"],"key":"passengersWrong","stage":"1"}` || jr.Events[0].Message != "wrongKey: sent as passengersWrong" {
+			t.Errorf("expected data to be sent as default wrong key, got %v, %v", sent, jr.Events)
+		}
+	})
+
+	t.Run("no answer", func(t *testing.T) {
+		jr := run(Fault{Type: FaultNoAnswer})
+		jr.CreateInput()
+		if len(sent) != 0 || len(jr.Events) != 1 || jr.Events[0].Message != "noAnswer" {
+			t.Errorf("expected input never to be answered, got %v, %v", sent, jr.Events)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		jr := run(Fault{Type: FaultDelay, Delay: 20 * time.Millisecond})
+		jr.CreateInput()
+		if len(sent) != 0 || len(jr.Events) != 1 || jr.Events[0].Message != "delay: answer held for 20ms" {
+			t.Errorf("expected answer to be held, got %v, %v", sent, jr.Events)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if err := jr.CreateInput(); err != nil || len(sent) != 1 {
+			t.Errorf("expected input to be answered after delay, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		jr := run(Fault{Type: FaultDecline})
+		if len(sent) != 0 || jr.Job.State != "canceled" || jr.Events[1].Message != "input passengers declined by fault injection" {
+			t.Errorf("expected job to be canceled, got %v, %v", sent, jr.Events)
+		}
+		result, err := jr.CollectResult()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Faults) != 1 || !result.Faults[0].Passed || result.Faults[0].Type != FaultDecline || !result.Passed() {
+			t.Errorf("expected canceled job to pass, got %+v", result.Faults)
+		}
+	})
+
+	t.Run("expected error code", func(t *testing.T) {
+		jr := run(Fault{Type: FaultNoAnswer, ExpectErrorCode: "InputTimeout"})
+		job = `{"id": "job-id", "state": "fail", "error": {"code": "InputTimeout", "category": "client"}}`
+		result, err := jr.CollectResult()
+		if err != nil || !result.Passed() || result.Faults[0].ErrorCode != "InputTimeout" {
+			t.Errorf("expected fault with expected error code to pass, got %+v, %v", result.Faults, err)
+		}
+
+		job = `{"id": "job-id", "state": "fail", "error": {"code": "ServerError", "category": "server"}}`
+		if result, _ = jr.CollectResult(); result.Passed() || result.Faults[0].Passed {
+			t.Errorf("expected fault with other error code to fail, got %+v", result.Faults)
+		}
+	})
+
+	t.Run("invalid fault", func(t *testing.T) {
+		job = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.Faults = map[string]Fault{"passengers": {Type: FaultDelay}}
+		jr.ResumeJob("job-id", "Flight")
+		expectError(t, "delay fault of input passengers requires delay", jr.CreateInput())
+		jr.JobRun.Faults = map[string]Fault{"passengers": {Type: "corrupt"}}
+		expectError(t, "unknown fault type corrupt of input passengers", jr.CreateInput())
+	})
+}
@@ -0,0 +1,167 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// ServiceSummary is an aggregate of job runs of a single service.
+type ServiceSummary struct {
+	ServiceId string
+	Summary
+}
+
+// SuccessRate is a percentage of passed runs.
+func (s ServiceSummary) SuccessRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Passed) * 100 / float64(s.Total)
+}
+
+// SummarizeServices groups results by service, services are ordered by id.
+func SummarizeServices(results []RunResult) (summaries []ServiceSummary) {
+	byService := make(map[string][]RunResult)
+	for _, r := range results {
+		byService[r.ServiceId] = append(byService[r.ServiceId], r)
+	}
+
+	for serviceId, rs := range byService {
+		summaries = append(summaries, ServiceSummary{serviceId, Summarize(rs)})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].ServiceId < summaries[j].ServiceId
+	})
+	return
+}
+
+// WriteHTMLReport writes self-contained html page with summary, per-service success rate
+// and details of each job run: timeline, inputs, outputs, errors and assertions.
+func WriteHTMLReport(w io.Writer, results []RunResult) error {
+	return htmlReport.Execute(w, struct {
+		GeneratedAt time.Time
+		Summary     Summary
+		Services    []ServiceSummary
+		Results     []RunResult
+	}{
+		GeneratedAt: timeNow().UTC(),
+		Summary:     Summarize(results),
+		Services:    SummarizeServices(results),
+		Results:     results,
+	})
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"json": func(v interface{}) string {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	},
+	"offset": func(r RunResult, t time.Time) string {
+		start := r.StartedAt
+		if start.IsZero() && len(r.Events) > 0 {
+			start = r.Events[0].Time
+		}
+		return t.Sub(start).Round(time.Millisecond).String()
+	},
+	"percent": func(f float64) string {
+		return fmt.Sprintf("%.1f%%", f)
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"timestamp": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Job runner report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+pre { margin: 0; font-size: 12px; white-space: pre-wrap; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+details { border: 1px solid #ddd; margin: 0.5em 0; padding: 0.5em; }
+summary { cursor: pointer; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Job runner report</h1>
+<p>Generated at {{timestamp .GeneratedAt}}</p>
+<table>
+<tr><th>Total</th><th>Passed</th><th>Failed</th></tr>
+<tr><td>{{.Summary.Total}}</td><td class="passed">{{.Summary.Passed}}</td><td class="failed">{{.Summary.Failed}}</td></tr>
+</table>
+<h2>Services</h2>
+<table>
+<tr><th>Service</th><th>Total</th><th>Passed</th><th>Failed</th><th>Success rate</th></tr>
+{{- range .Services}}
+<tr><td>{{.ServiceId}}</td><td>{{.Total}}</td><td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{percent .SuccessRate}}</td></tr>
+{{- end}}
+</table>
+<h2>Jobs</h2>
+{{- range .Results}}
+{{- $result := .}}
+<details{{if not .Passed}} open{{end}}>
+<summary class="{{if .Passed}}passed{{else}}failed{{end}}">{{.Name}} &mdash; {{.State}}{{if .ErrorCode}} ({{.ErrorCode}}){{end}}</summary>
+<table>
+<tr><th>Job</th><td>{{.JobId}}</td></tr>
+<tr><th>Started</th><td>{{timestamp .StartedAt}}</td></tr>
+<tr><th>Duration</th><td>{{duration .Duration}}</td></tr>
+{{- if .ErrorCode}}
+<tr><th>Error</th><td>{{.ErrorCode}} ({{.ErrorCategory}})</td></tr>
+{{- end}}
+{{- if .Overrides}}
+<tr><th>Overrides</th><td><pre>{{json .Overrides}}</pre></td></tr>
+{{- end}}
+{{- if .UnansweredInputKeys}}
+<tr><th>Unanswered inputs</th><td>{{range $i, $k := .UnansweredInputKeys}}{{if $i}}, {{end}}{{$k}}{{end}}</td></tr>
+{{- end}}
+{{- range .Faults}}
+<tr><th>Fault {{.Type}} of {{.Key}}</th><td class="{{if .Passed}}passed{{else}}failed{{end}}">error {{if .ErrorCode}}{{.ErrorCode}}{{else}}none{{end}}{{if .ExpectErrorCode}}, expected {{.ExpectErrorCode}}{{end}}</td></tr>
+{{- end}}
+{{- if .DeclinedInputs}}
+<tr><th>Declined consents</th><td>{{range $i, $d := .DeclinedInputs}}{{if $i}}<br>{{end}}{{$d}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if .Assertions}}
+<h3>Assertions</h3>
+<table>
+<tr><th>Output</th><th>Check</th><th>Result</th><th>Diff</th></tr>
+{{- range .Assertions}}
+<tr><td>{{.OutputKey}}{{if .Path}}.{{.Path}}{{end}}</td><td>{{.Check}}</td><td class="{{if .Passed}}passed">passed{{else}}failed">failed{{end}}</td><td><pre>{{.Diff}}</pre></td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h3>Timeline</h3>
+<table>
+<tr><th>Time</th><th>Event</th><th>Key</th><th>Data</th><th>Message</th></tr>
+{{- range .Events}}
+<tr><td>+{{offset $result .Time}}</td><td>{{.Type}}</td><td>{{.Key}}</td><td>{{if .Data}}<pre>{{json .Data}}</pre>{{end}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- if .Outputs}}
+<h3>Outputs</h3>
+<table>
+<tr><th>Key</th><th>Data</th></tr>
+{{- range .Outputs}}
+<tr><td>{{.Key}}</td><td><pre>{{json .Data}}</pre></td></tr>
+{{- end}}
+</table>
+{{- end}}
+</details>
+{{- end}}
+</body>
+</html>
+`))
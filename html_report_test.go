@@ -0,0 +1,51 @@
+package jobrunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	results := append([]RunResult{}, reportResults...)
+	results[0].Outputs = []JobOutput{{Key: "finalPrice", Data: map[string]interface{}{"value": 100}}}
+	results[1].Events = []Event{{Type: EventInputUnresolved, Key: "selectedSeats", Message: "<unexpected>"}}
+
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+
+	for _, expected := range []string{
+		`<td>2</td><td class="passed">1</td><td class="failed">1</td>`,
+		`<tr><td>service-id</td><td>2</td><td>1</td><td>1</td><td>50.0%</td></tr>`,
+		`<summary class="passed">service-id/Flight/one-way &mdash; success</summary>`,
+		`<summary class="failed">service-id/Flight &mdash; fail (SeatsUnavailable)</summary>`,
+		`<tr><th>Unanswered inputs</th><td>selectedSeats</td></tr>`,
+		`<td>finalPrice</td><td><pre>{
+  &#34;value&#34;: 100
+}</pre></td>`,
+		`<td>&lt;unexpected&gt;</td>`,
+		`<td>+0s</td><td>jobCreated</td>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected report to contain %s", expected)
+		}
+	}
+
+	if strings.Contains(html, "<link") || strings.Contains(html, "<script") {
+		t.Error("expected report to be self-contained")
+	}
+}
+
+func TestSummarizeServices(t *testing.T) {
+	summaries := SummarizeServices([]RunResult{
+		{ServiceId: "b", State: "success"},
+		{ServiceId: "a", State: "fail"},
+		{ServiceId: "b", State: "fail"},
+	})
+	if len(summaries) != 2 || summaries[0].ServiceId != "a" || summaries[1].SuccessRate() != 50 {
+		t.Errorf("unexpected summaries %v", summaries)
+	}
+}
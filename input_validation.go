@@ -0,0 +1,199 @@
+package jobrunner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+const defaultProtocolUrl = "https://protocol.automationcloud.net"
+
+// EventInputInvalid is recorded when input data does not match its schema.
+const EventInputInvalid = "inputInvalid"
+
+// ValidationMode decides what happens when input data does not match schema from protocol.
+type ValidationMode string
+
+// Validation modes, inputs are not validated by default.
+const (
+	ValidationOff  ValidationMode = ""
+	ValidationWarn ValidationMode = "warn"
+	ValidationFail ValidationMode = "fail"
+)
+
+// SchemaError is returned when input data does not match schema of domain input and JobRun.ValidateInputs is ValidationFail.
+type SchemaError struct {
+	Key        string
+	Violations []SchemaViolation
+}
+
+// Error makes string representation of a schema error.
+func (e SchemaError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		lines = append(lines, v.String())
+	}
+	return "input " + e.Key + " does not match schema: " + strings.Join(lines, "; ")
+}
+
+// WithProtocolUrl allows to alternate location of a protocol, protocol loaded from previous location is dropped.
+func (jr *JobRunner) WithProtocolUrl(url string) *JobRunner {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jr.protocolUrl = url
+	jr.protocolDoc = nil
+	// api client caches protocol, so a new one is made
+	jr.apiClient = cl.NewApiClient(jr.httpClient, jr.apiClient.SecretKey).WithBaseURL(jr.baseUrl).WithProtocolURL(url)
+	return jr
+}
+
+// protocolSchema loads raw protocol schema, it contains type definitions client-go does not expose.
+func (jr *JobRunner) protocolSchema() (map[string]interface{}, error) {
+	if jr.protocolDoc != nil {
+		return jr.protocolDoc, nil
+	}
+
+	url := jr.protocolUrl
+	if url == "" {
+		url = defaultProtocolUrl
+	}
+
+	res, err := jr.httpClient.Get(url + "/schema.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unable to load protocol schema: %s", res.Status)
+	}
+
+	var doc map[string]interface{}
+	if err := readJSON(res.Body, &doc); err != nil {
+		return nil, err
+	}
+	jr.protocolDoc = doc
+	return doc, nil
+}
+
+// inputSchema finds JSON Schema of domain input in protocol schema. Input definition is either a schema itself
+// or holds one in "schema" property, "$ref" (JSON pointer within protocol) and "typeRef" (name of a type
+// defined in "types" of the domain or of the protocol, optionally prefixed with domain id) are resolved.
+func inputSchema(doc map[string]interface{}, domainId, key string) (schema map[string]interface{}, schemaPath string, found bool) {
+	return definitionSchema(doc, domainId, "inputs", key)
+}
+
+// definitionSchema finds JSON Schema of domain input or output (kind is "inputs" or "outputs"), see inputSchema.
+func definitionSchema(doc map[string]interface{}, domainId, kind, key string) (schema map[string]interface{}, schemaPath string, found bool) {
+	schemaPath = "#/domains/" + escapePointer(domainId) + "/" + kind + "/" + escapePointer(key)
+	value, _ := resolvePointer(doc, strings.TrimPrefix(schemaPath, "#"))
+	def, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, "", false
+	}
+
+	if s, ok := def["schema"].(map[string]interface{}); ok {
+		return s, schemaPath + "/schema", true
+	}
+
+	for _, keyword := range []string{"type", "$ref", "typeRef", "properties", "enum", "const", "oneOf", "anyOf", "allOf"} {
+		if _, ok := def[keyword]; ok {
+			return def, schemaPath, true
+		}
+	}
+	return nil, "", false
+}
+
+// protocolResolver resolves "$ref" pointers and "typeRef" type names within protocol schema.
+func protocolResolver(doc map[string]interface{}, domainId string) schemaResolver {
+	byPointer := pointerResolver(doc)
+	return func(schema map[string]interface{}) (map[string]interface{}, string, bool) {
+		if resolved, path, ok := byPointer(schema); ok {
+			return resolved, path, true
+		}
+
+		ref, _ := schema["typeRef"].(string)
+		if ref == "" {
+			return nil, "", false
+		}
+
+		var candidates []string
+		if i := strings.Index(ref, "."); i > 0 {
+			candidates = append(candidates, "/domains/"+escapePointer(ref[:i])+"/types/"+escapePointer(ref[i+1:]))
+		}
+		candidates = append(candidates,
+			"/domains/"+escapePointer(domainId)+"/types/"+escapePointer(ref),
+			"/types/"+escapePointer(ref),
+		)
+		for _, pointer := range candidates {
+			if value, ok := resolvePointer(doc, pointer); ok {
+				if s, ok := value.(map[string]interface{}); ok {
+					return s, "#" + pointer, true
+				}
+			}
+		}
+		return nil, "", false
+	}
+}
+
+// validateInput checks input data against its schema according to JobRun.ValidateInputs.
+// Inputs without schema in protocol are considered valid.
+func (jr *JobRunner) validateInput(key string, data interface{}) error {
+	mode := jr.JobRun.ValidateInputs
+	if mode == ValidationOff {
+		return nil
+	}
+
+	doc, err := jr.protocolSchema()
+	if err != nil {
+		if mode == ValidationFail {
+			return err
+		}
+		fmt.Println("unable to validate input", key+":", err)
+		return nil
+	}
+
+	schema, schemaPath, found := inputSchema(doc, jr.DomainId, key)
+	if !found {
+		return nil
+	}
+
+	v := schemaValidator{
+		resolve: protocolResolver(doc, jr.DomainId),
+		sensitive: func(path string) (string, bool) {
+			tokens, _ := pointerTokens(path)
+			return jr.Redactor.maskPath(append([]string{key}, tokens...))
+		},
+	}
+	violations := v.validate(schema, normalizeJSON(data), "", schemaPath)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	schemaErr := SchemaError{Key: key, Violations: violations}
+	jr.record(Event{Type: EventInputInvalid, Key: key, Message: schemaErr.Error()})
+	if mode == ValidationFail {
+		return schemaErr
+	}
+	fmt.Println("warning:", schemaErr.Error())
+	return nil
+}
+
+// validateInputs checks every input of initial job data, keys are validated in alphabetical order.
+func (jr *JobRunner) validateInputs(data map[string]interface{}) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := jr.validateInput(k, data[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
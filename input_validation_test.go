@@ -0,0 +1,156 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestInputValidation(t *testing.T) {
+	var sent []string
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://protocol/schema.json":
+			body = `{
+				"domains": {
+					"Flight": {
+						"inputs": {
+							"url": {"type": "string", "pattern": "^https?://"},
+							"passengers": {"schema": {"type": "array", "items": {"typeRef": "Passenger"}}},
+							"seat": {"typeRef": "Seat"},
+							"payment": {"type": "object", "properties": {"card": {"type": "object", "properties": {"pan": {"type": "string", "pattern": "^4"}}}}},
+							"notes": {"description": "no schema"}
+						},
+						"types": {
+							"Passenger": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+						}
+					}
+				},
+				"types": {
+					"Seat": {"$ref": "#/definitions/Seat"}
+				},
+				"definitions": {
+					"Seat": {"type": "string", "minLength": 2}
+				}
+			}`
+		case "GET http://other-protocol/schema.json":
+			body = `{"domains": {"Flight": {"inputs": {"url": {"type": "string"}}}}}`
+		case "POST http://jib":
+			body = `{"url": "ftp://ubio.air", "notes": 1}`
+		case "POST http://api/jobs":
+			body = `{"id": "job-id"}`
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	newRunner := func() *JobRunner {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		return jr.WithProtocolUrl("http://protocol")
+	}
+
+	t.Run("initial data fails fast", func(t *testing.T) {
+		jr := newRunner()
+		_, err := jr.RunJob(JobRun{ServiceId: "service-id", DomainId: "Flight", ValidateInputs: ValidationFail})
+		expectError(t, `input url does not match schema: /: value "ftp://ubio.air" does not match "^https?://" (schema #/domains/Flight/inputs/url/pattern)`, err)
+		if len(jr.Jobs) != 0 {
+			t.Errorf("expected job not to be created")
+		}
+		if len(jr.Events) != 1 || jr.Events[0].Type != EventInputInvalid || jr.Events[0].Key != "url" {
+			t.Errorf("expected invalid input to be recorded, got %v", jr.Events)
+		}
+	})
+
+	t.Run("initial data warns", func(t *testing.T) {
+		jr := newRunner()
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", DomainId: "Flight", ValidateInputs: ValidationWarn}); err != nil {
+			t.Fatal(err)
+		}
+		if len(jr.Jobs) != 1 || jr.Events[0].Type != EventInputInvalid {
+			t.Errorf("expected job to be created despite invalid input, got %v", jr.Events)
+		}
+	})
+
+	t.Run("input resolves typeRef", func(t *testing.T) {
+		jr := newRunner()
+		jr.JobRun.ValidateInputs = ValidationFail
+		jr.InputData = map[string]interface{}{"passengers": []interface{}{map[string]interface{}{"name": 1}}}
+		jr.ResumeJob("job-id", "Flight")
+		err := jr.CreateInput()
+		expectError(t, "input passengers does not match schema: /0/name: expected string, got integer (schema #/domains/Flight/types/Passenger/properties/name/type)", err)
+		if len(sent) != 0 {
+			t.Errorf("expected invalid input not to be sent, got %v", sent)
+		}
+	})
+
+	t.Run("input resolves global typeRef and $ref", func(t *testing.T) {
+		jr := newRunner()
+		jr.JobRun.ValidateInputs = ValidationFail
+		jr.DomainId = "Flight"
+		if err := jr.validateInput("seat", "A"); err == nil || err.(SchemaError).Violations[0].SchemaPath != "#/definitions/Seat/minLength" {
+			t.Errorf("expected seat to be invalid, got %v", err)
+		}
+		if err := jr.validateInput("notes", 1); err != nil {
+			t.Errorf("expected input without schema to be valid, got %v", err)
+		}
+	})
+
+	t.Run("sensitive values are redacted in violations", func(t *testing.T) {
+		jr := newRunner()
+		jr.JobRun.ValidateInputs = ValidationWarn
+		jr.Redactor = NewRedactor()
+		jr.DomainId = "Flight"
+		payment := map[string]interface{}{"card": map[string]interface{}{"pan": "5555555555554444"}}
+		if err := jr.validateInput("payment", payment); err != nil {
+			t.Fatal(err)
+		}
+		expected := `input payment does not match schema: /card/pan: value [REDACTED] does not match "^4" (schema #/domains/Flight/inputs/payment/properties/card/properties/pan/pattern)`
+		if len(jr.Events) != 1 || jr.Events[0].Message != expected {
+			t.Errorf("expected card number to be redacted, got %v", jr.Events)
+		}
+
+		jr.Redactor = nil
+		jr.JobRun.ValidateInputs = ValidationFail
+		err := jr.validateInput("payment", payment)
+		expectError(t, `input payment does not match schema: /card/pan: value "5555555555554444" does not match "^4" (schema #/domains/Flight/inputs/payment/properties/card/properties/pan/pattern)`, err)
+	})
+
+	t.Run("protocol url changed", func(t *testing.T) {
+		jr := newRunner()
+		jr.JobRun.ValidateInputs = ValidationFail
+		jr.DomainId = "Flight"
+		if err := jr.validateInput("url", "ftp://ubio.air"); err == nil {
+			t.Fatal("expected url to be invalid")
+		}
+		jr.WithProtocolUrl("http://other-protocol")
+		if err := jr.validateInput("url", "ftp://ubio.air"); err != nil {
+			t.Errorf("expected url to be validated against new protocol, got %v", err)
+		}
+		if prot, err := jr.apiClient.GetProtocol(); err != nil || len(prot.Domains["Flight"].Inputs) != 1 {
+			t.Errorf("expected api client to load new protocol, got %v, %v", prot, err)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		jr := newRunner()
+		jr.InputData = map[string]interface{}{"passengers": "invalid"}
+		jr.ResumeJob("job-id", "Flight")
+		if err := jr.CreateInput(); err != nil || len(sent) != 1 {
+			t.Errorf("expected input to be sent, got %v, %v", sent, err)
+		}
+	})
+}
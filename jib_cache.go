@@ -0,0 +1,110 @@
+package jobrunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// JibSeedKey is a jib config property holding seed of a random data generator.
+const JibSeedKey = "seed"
+
+// WithSeed returns a copy of jib config with seed attached, jib generates the same data for the same seed.
+func WithSeed(config JibConfig, seed int64) JibConfig {
+	result := make(JibConfig, len(config)+1)
+	for k, v := range config {
+		result[k] = v
+	}
+	result[JibSeedKey] = seed
+	return result
+}
+
+// JibCacheMode decides whether JibCache records jib responses or replays recorded ones.
+type JibCacheMode string
+
+// Jib cache modes.
+const (
+	JibCacheRecord JibCacheMode = "record"
+	JibCacheReplay JibCacheMode = "replay"
+)
+
+// JibCache stores jib responses in files keyed by hash of JibCacheKey, options are:
+// - Dir: directory where responses are stored, required
+// - Mode: JibCacheRecord calls jib and stores every response, JibCacheReplay serves stored responses without calling jib
+type JibCache struct {
+	Dir  string       `json:"dir"`
+	Mode JibCacheMode `json:"mode"`
+}
+
+// JibCacheKey identifies recorded jib response by jib config before it is rendered along with everything
+// the template may depend on except date, so responses recorded on one day are replayed on the next.
+// Env holds values of environment variables the template reads with env function.
+// Seed is the one of rendered config, jobs generating unique data get responses of their own by JobIndex.
+type JibCacheKey struct {
+	Config   JibConfig              `json:"config"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+	Env      map[string]string      `json:"env,omitempty"`
+	Seed     interface{}            `json:"seed,omitempty"`
+	RunIndex int                    `json:"runIndex,omitempty"`
+	JobIndex int                    `json:"jobIndex,omitempty"`
+}
+
+// jibRecord is a recorded pair of jib request and response.
+type jibRecord struct {
+	Key    JibCacheKey            `json:"key"`
+	Config JibConfig              `json:"config"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+// File returns location of a recorded response for given key.
+func (c *JibCache) File(key JibCacheKey) string {
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return filepath.Join(c.Dir, "jib-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// GenerateData generates input for a job from rendered jib config according to cache mode, nil cache always calls jib.
+func (c *JibCache) GenerateData(jibUrl string, key JibCacheKey, config JibConfig, client *http.Client) (map[string]interface{}, error) {
+	if c == nil {
+		return GenerateData(jibUrl, config, client)
+	}
+
+	filename := c.File(key)
+	switch c.Mode {
+	case JibCacheReplay:
+		b, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			return nil, errors.New("no recorded jib response for config in " + filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record jibRecord
+		if err := decodeJSON(b, &record); err != nil {
+			return nil, err
+		}
+		return record.Data, nil
+	case JibCacheRecord:
+		data, err := GenerateData(jibUrl, config, client)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.MarshalIndent(jibRecord{key, config, data}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(c.Dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, errors.New("unknown jib cache mode " + string(c.Mode))
+}
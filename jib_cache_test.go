@@ -0,0 +1,136 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJibCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			calls++
+			body = `{"passengers": [{"name": "Bob` + strconv.Itoa(calls) + `"}], "loyaltyNumber": 9007199254740993}`
+		case "POST http://api/jobs":
+			body = `{"id": "job-id"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	today := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return today }
+	defer func() { timeNow = time.Now }()
+
+	config := JibConfig{"adults": 1, "outboundDate": "{{ .Date | addDays 30 }}"}
+	key := JibCacheKey{Config: config}
+	expected := map[string]interface{}{
+		"passengers":    []interface{}{map[string]interface{}{"name": "Bob1"}},
+		"loyaltyNumber": json.Number("9007199254740993"),
+	}
+
+	t.Run("seed", func(t *testing.T) {
+		original := JibConfig{"adults": 1}
+		seeded := WithSeed(original, 42)
+		if seeded[JibSeedKey] != int64(42) || len(original) != 1 {
+			t.Errorf("expected seed to be attached to a copy, got %v and %v", seeded, original)
+		}
+	})
+
+	t.Run("record", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JibCache = &JibCache{Dir: dir, Mode: JibCacheRecord}
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", JibConfig: config}); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 1 {
+			t.Errorf("expected jib to be called, got %d calls", calls)
+		}
+		if _, err := os.Stat(jr.JibCache.File(key)); err != nil {
+			t.Errorf("expected response to be recorded, got %v", err)
+		}
+	})
+
+	t.Run("replay on another day", func(t *testing.T) {
+		today = today.AddDate(0, 0, 1)
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JibCache = &JibCache{Dir: dir, Mode: JibCacheReplay}
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", JibConfig: config}); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 1 {
+			t.Errorf("expected jib not to be called, got %d calls", calls)
+		}
+		if !reflect.DeepEqual(jr.InputData, expected) {
+			t.Errorf("expected recorded data %v, got %v", expected, jr.InputData)
+		}
+	})
+
+	t.Run("unique data", func(t *testing.T) {
+		run := JobRun{ServiceId: "service-id", JibConfig: config, HowMany: 2, UniqueData: true}
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JibCache = &JibCache{Dir: dir, Mode: JibCacheRecord}
+		if _, err := jr.RunJob(run); err != nil {
+			t.Fatal(err)
+		}
+
+		jr = NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JibCache = &JibCache{Dir: dir, Mode: JibCacheReplay}
+		datasets, err := jr.generateDatasets(run, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if toJSON(datasets[0]) == toJSON(datasets[1]) {
+			t.Errorf("expected each job to replay its own data, got %v", datasets)
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		defer os.Unsetenv("JIB_TEST_MARKET")
+		run := JobRun{ServiceId: "service-id", JibConfig: JibConfig{"market": `{{ env "JIB_TEST_MARKET" }}`}}
+		runWith := func(market string, mode JibCacheMode) error {
+			os.Setenv("JIB_TEST_MARKET", market)
+			jr := NewRunner(client, "apikey", "http://api", "http://jib")
+			jr.JibCache = &JibCache{Dir: dir, Mode: mode}
+			_, err := jr.RunJob(run)
+			return err
+		}
+
+		if err := runWith("gb", JibCacheRecord); err != nil {
+			t.Fatal(err)
+		}
+		if err := runWith("gb", JibCacheReplay); err != nil {
+			t.Errorf("expected response recorded with the same environment to be replayed, got %v", err)
+		}
+		if err := runWith("de", JibCacheReplay); err == nil {
+			t.Errorf("expected response recorded with other environment not to be replayed")
+		}
+	})
+
+	t.Run("replay missing", func(t *testing.T) {
+		cache := &JibCache{Dir: dir, Mode: JibCacheReplay}
+		other := JibCacheKey{Config: WithSeed(config, 43), Seed: 43}
+		_, err := cache.GenerateData("http://jib", other, other.Config, client)
+		expectError(t, "no recorded jib response for config in "+cache.File(other), err)
+	})
+}
@@ -0,0 +1,212 @@
+package jobrunner
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Date is a calendar date available in jib config templates, it is printed as "2006-01-02".
+type Date struct {
+	time.Time
+}
+
+// String formats date as "2006-01-02".
+func (d Date) String() string {
+	return d.Format("2006-01-02")
+}
+
+// TemplateData is available in jib config templates:
+// - Date: date of a run, e.g. {{ .Date | addDays 30 }}
+// - RunIndex: position of a run in expanded matrix, starting from 0
+// - JobIndex: position of a job among JobRun.HowMany jobs with unique data, starting from 0
+// - Vars: variables of a run, including values picked from matrix, e.g. {{ .Vars.route }}
+type TemplateData struct {
+	Date     Date
+	RunIndex int
+	JobIndex int
+	Vars     map[string]interface{}
+	// getenv replaces os.Getenv behind env function when set, e.g. to learn which variables template reads.
+	getenv func(name string) string
+}
+
+// templateFuncs are functions available in jib config templates in addition to text/template builtins.
+var templateFuncs = template.FuncMap{
+	"addDays":   func(days int, d Date) Date { return Date{d.AddDate(0, 0, days)} },
+	"addMonths": func(months int, d Date) Date { return Date{d.AddDate(0, months, 0)} },
+	"addYears":  func(years int, d Date) Date { return Date{d.AddDate(years, 0, 0)} },
+	"format":    func(layout string, d Date) string { return d.Format(layout) },
+	"env":       os.Getenv,
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+}
+
+// RenderJibConfig returns a copy of jib config with templates in string values executed.
+// String which consists of a single template action and renders into json number, boolean, array or object
+// is replaced with decoded value, e.g. "{{ .Vars.adults }}" becomes 2 rather than "2".
+func RenderJibConfig(config JibConfig, data TemplateData) (JibConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	rendered, err := renderValue(config, data, "")
+	if err != nil {
+		return nil, err
+	}
+	result, _ := rendered.(map[string]interface{})
+	return result, nil
+}
+
+func renderValue(value interface{}, data TemplateData, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := renderValue(item, data, joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			result[k] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, data, joinPath(path, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		return renderString(v, data, path)
+	}
+	return value, nil
+}
+
+func renderString(s string, data TemplateData, path string) (interface{}, error) {
+	tmpl := template.New(path).Funcs(templateFuncs)
+	if data.getenv != nil {
+		tmpl.Funcs(template.FuncMap{"env": data.getenv})
+	}
+	tmpl, err := tmpl.Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, errors.New("invalid template in jib config: " + err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.New("unable to render jib config: " + err.Error())
+	}
+
+	trimmed := strings.TrimSpace(s)
+	singleAction := strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") && strings.Count(trimmed, "{{") == 1
+	if singleAction {
+		var decoded interface{}
+		if err := decodeJSON(buf.Bytes(), &decoded); err == nil {
+			if _, isString := decoded.(string); !isString && decoded != nil {
+				return decoded, nil
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+// Expand fans out job run with Matrix into a job run per combination of matrix values (cartesian product),
+// picked values are added to Vars and Label. Job run without Matrix expands into itself,
+// variable with empty list of values leaves nothing to run.
+func (jobRun JobRun) Expand() []JobRun {
+	names := make([]string, 0, len(jobRun.Matrix))
+	for name := range jobRun.Matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []map[string]interface{}{{}}
+	for _, name := range names {
+		var next []map[string]interface{}
+		for _, combination := range combinations {
+			for _, value := range jobRun.Matrix[name] {
+				c := make(map[string]interface{}, len(combination)+1)
+				for k, v := range combination {
+					c[k] = v
+				}
+				c[name] = value
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+
+	runs := make([]JobRun, 0, len(combinations))
+	for i, combination := range combinations {
+		run := jobRun
+		run.Matrix = nil
+		run.RunIndex = i
+		run.Vars = make(map[string]interface{}, len(jobRun.Vars)+len(combination))
+		for k, v := range jobRun.Vars {
+			run.Vars[k] = v
+		}
+
+		picked := make([]string, 0, len(names))
+		for _, name := range names {
+			run.Vars[name] = combination[name]
+			picked = append(picked, name+"="+formatVar(combination[name]))
+		}
+		if len(picked) > 0 {
+			run.Label = strings.TrimSpace(jobRun.Label + " [" + strings.Join(picked, ", ") + "]")
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+func formatVar(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return toJSON(v)
+}
+
+// generateData renders jib config of a job run, generates input data and applies overrides.
+func (jr *JobRunner) generateData(jobRun JobRun, jobIndex int) (map[string]interface{}, error) {
+	env := make(map[string]string)
+	year, month, day := timeNow().Date()
+	config, err := RenderJibConfig(jobRun.JibConfig, TemplateData{
+		Date:     Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)},
+		RunIndex: jobRun.RunIndex,
+		JobIndex: jobIndex,
+		Vars:     jobRun.Vars,
+		getenv: func(name string) string {
+			env[name] = os.Getenv(name)
+			return env[name]
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	config = withJobSeed(config, jobIndex)
+
+	key := JibCacheKey{
+		Config:   jobRun.JibConfig,
+		Vars:     jobRun.Vars,
+		Env:      env,
+		Seed:     config[JibSeedKey],
+		RunIndex: jobRun.RunIndex,
+		JobIndex: jobIndex,
+	}
+	data, err := jr.JibCache.GenerateData(jr.JibUrl, key, config, jr.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return jobRun.Overrides.Apply(data)
+}
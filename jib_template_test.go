@@ -0,0 +1,148 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderJibConfig(t *testing.T) {
+	data := TemplateData{
+		Date:     Date{time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)},
+		RunIndex: 3,
+		Vars:     map[string]interface{}{"route": "LHR-JFK", "adults": 2},
+	}
+
+	t.Run("renders templates", func(t *testing.T) {
+		os.Setenv("JOBRUNNER_TEST_CARD", "visa")
+		defer os.Unsetenv("JOBRUNNER_TEST_CARD")
+
+		config, err := RenderJibConfig(JibConfig{
+			"outbound": "{{ .Date | addDays 30 }}",
+			"inbound":  "{{ .Date | addMonths 1 | format \"02/01/2006\" }}",
+			"route":    "route {{ .Vars.route }} #{{ .RunIndex }}",
+			"adults":   "{{ .Vars.adults }}",
+			"cards":    []interface{}{"{{ env \"JOBRUNNER_TEST_CARD\" | upper }}", 1},
+			"plain":    "no template",
+		}, data)
+		expected := JibConfig{
+			"outbound": "2020-03-01",
+			"inbound":  "02/03/2020",
+			"route":    "route LHR-JFK #3",
+			"adults":   json.Number("2"),
+			"cards":    []interface{}{"VISA", 1},
+			"plain":    "no template",
+		}
+		if err != nil || !reflect.DeepEqual(config, expected) {
+			t.Errorf("expected %v, got %v, %v", expected, config, err)
+		}
+	})
+
+	t.Run("missing variable", func(t *testing.T) {
+		_, err := RenderJibConfig(JibConfig{"cabin": "{{ .Vars.cabin }}"}, data)
+		if err == nil || !strings.HasPrefix(err.Error(), "unable to render jib config: ") {
+			t.Errorf("expected render error, got %v", err)
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := RenderJibConfig(JibConfig{"a": map[string]interface{}{"b": "{{ .Vars"}}, data)
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid template in jib config: template: a.b:") {
+			t.Errorf("expected parse error, got %v", err)
+		}
+	})
+}
+
+func TestExpand(t *testing.T) {
+	t.Run("cartesian product", func(t *testing.T) {
+		runs := JobRun{
+			Label:  "smoke",
+			Vars:   map[string]interface{}{"cabin": "economy"},
+			Matrix: map[string][]interface{}{"route": {"LHR-JFK", "LGW-CDG"}, "adults": {1, 2}},
+		}.Expand()
+
+		labels := make([]string, 0, len(runs))
+		for i, run := range runs {
+			labels = append(labels, run.Label)
+			if run.RunIndex != i || run.Matrix != nil || run.Vars["cabin"] != "economy" {
+				t.Errorf("unexpected job run %v", run)
+			}
+		}
+		expected := []string{
+			"smoke [adults=1, route=LHR-JFK]",
+			"smoke [adults=1, route=LGW-CDG]",
+			"smoke [adults=2, route=LHR-JFK]",
+			"smoke [adults=2, route=LGW-CDG]",
+		}
+		if !reflect.DeepEqual(labels, expected) {
+			t.Errorf("expected %v, got %v", expected, labels)
+		}
+		if runs[3].Vars["adults"] != 2 || runs[3].Vars["route"] != "LGW-CDG" {
+			t.Errorf("expected picked values to be added to vars, got %v", runs[3].Vars)
+		}
+	})
+
+	t.Run("no matrix", func(t *testing.T) {
+		runs := JobRun{ServiceId: "service-id", Label: "smoke"}.Expand()
+		if len(runs) != 1 || runs[0].Label != "smoke" || runs[0].ServiceId != "service-id" {
+			t.Errorf("expected job run to expand into itself, got %v", runs)
+		}
+	})
+
+	t.Run("run jobs", func(t *testing.T) {
+		var configs []string
+		client := newTestClient(func(req *http.Request) *http.Response {
+			var body string
+			switch request := req.Method + " " + req.URL.String(); request {
+			case "POST http://jib":
+				b, _ := ioutil.ReadAll(req.Body)
+				configs = append(configs, string(b))
+				body = `{}`
+			case "POST http://api/jobs":
+				body = `{"id": "job-id"}`
+			default:
+				panic("undeclared request: " + request)
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+				Header:     make(http.Header),
+			}
+		})
+
+		jobRun := JobRun{
+			ServiceId: "service-id",
+			JibConfig: JibConfig{"adults": "{{ .Vars.adults }}"},
+			Matrix:    map[string][]interface{}{"adults": {1, 2}},
+		}
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		_, err := jr.RunJob(jobRun)
+		expectError(t, "job run with matrix must be expanded into separate job runs, see JobRun.Expand", err)
+
+		for _, run := range jobRun.Expand() {
+			if _, err := jr.RunJob(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected := []string{`{"adults":1}`, `{"adults":2}`}
+		if !reflect.DeepEqual(configs, expected) {
+			t.Errorf("expected jib to be called with %v, got %v", expected, configs)
+		}
+
+		s := Snapshots{Dir: "snapshots"}
+		runs := jobRun.Expand()
+		if s.SnapshotFile(runs[0]) == s.SnapshotFile(runs[1]) {
+			t.Errorf("expected job runs with different vars to have different snapshots")
+		}
+		b, _ := json.Marshal(runs[1])
+		if !bytes.Contains(b, []byte(`"vars":{"adults":2},"runIndex":1`)) {
+			t.Errorf("expected vars to be serialized, got %s", b)
+		}
+	})
+}
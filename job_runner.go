@@ -6,6 +6,8 @@ import (
 	"errors"
 	"math"
 	"net/http"
+	"sync"
+	"time"
 
 	cl "github.com/automationcloud/client-go"
 )
@@ -14,44 +16,132 @@ import (
 func NewRunner(httpClient *http.Client, apiKey, baseUrl, jibUrl string) JobRunner {
 	return JobRunner{
 		httpClient: httpClient,
+		baseUrl:    baseUrl,
 		JibUrl:     jibUrl,
 		apiClient:  cl.NewApiClient(httpClient, apiKey).WithBaseURL(baseUrl),
 	}
 }
 
 // JobRunner manages job.
+// Its methods are safe for concurrent use, e.g. by webhook handler and polling goroutine,
+// exported fields however must not be accessed directly while runner is in use, see CurrentJob and Timeline.
 type JobRunner struct {
+	mu         sync.Mutex
 	apiClient  *cl.ApiClient
 	httpClient *http.Client
+	baseUrl    string
 	DomainId   string
 	Job        *cl.Job
-	JibUrl     string `json:"jibUrl"`
-	InputData  map[string]interface{}
+	// Jobs are jobs created by RunJob or resumed by ResumeJob, Job is the current one.
+	// Unfinished jobs of earlier runs stay among them, so they are still canceled, refreshed and polled.
+	Jobs      []*cl.Job
+	JibUrl    string `json:"jibUrl"`
+	InputData map[string]interface{}
+	// Expectations are checked against job outputs by CheckExpectations.
+	Expectations []Expectation
+	// JobRun is an instruction current job was run with, it identifies snapshots.
+	JobRun JobRun
+	// Events is a timeline of jobs created by RunJob or resumed by ResumeJob.
+	Events []Event
+	// Redactor masks sensitive data in events, results and snapshots, nothing is masked when nil.
+	Redactor *Redactor
+	// Resolvers are asked in order for inputs which can not be taken from InputData or derived from outputs.
+	Resolvers []InputResolver
+	// Mappings derive inputs from outputs, they are checked before outputs linked to inputs by protocol.
+	Mappings []MappingRule
+	// JibCache records jib responses or replays recorded ones, jib is always called when nil.
+	JibCache *JibCache
+	// Safety prevents RunJob from creating risky jobs, e.g. in production or with real cards, nothing is checked when nil.
+	// Its Confirm callback is called while runner is locked and must not use the runner.
+	Safety *SafetyPolicy
+	states map[string]*jobState
+	// protocolUrl is where protocol schema used to validate inputs is loaded from, see WithProtocolUrl.
+	protocolUrl string
+	protocolDoc map[string]interface{}
 }
 
 // JobRun is an instruction required to run a job using JobRunner, options are:
 // - ServiceId: id of automation service, required
 // - DomainId: id of domain, required
-// - JibConfig: job input bundler (jib) configuration, required
+// - JibConfig: job input bundler (jib) configuration, required, string values may be templates, see RenderJibConfig
 // - CallbackUrl: callback url for webhook
 // - HowMany: how many jobs with the same input data to run (used to test concurrency), defaults to 1
+// - Expectations: assertions about job outputs, see CheckExpectations
+// - Label: name of a jib configuration used in reports, optional
+// - Timeout: wall-clock budget of a job, job is canceled when exceeded, see Refresh
+// - InputTimeout: how long job may await the same input, job is canceled when exceeded, see Refresh
+// - DuplicateInputs: what to do when job awaits input which was already sent, defaults to DuplicateInputSkip
+// - ValidateInputs: whether to warn or fail when input data does not match schema from protocol, off by default
+// - Overrides: patches applied to data generated by jib before job is created, see Overrides
+// - Vars: variables available in jib config templates
+// - Matrix: lists of variable values, job run fans out into their cartesian product, see Expand
+// - RunIndex: position of a job run in expanded matrix, set by Expand
+// - UniqueData: generate separate input data for each of HowMany jobs instead of sharing the same data
+// - Parallelism: how many data generations may run at once when UniqueData is set, defaults to 1
+// - Consent: limits of prices runner consents to, it consents to any price when nil, see ConsentPolicy
+// - Faults: input keys answered wrongly on purpose to test error handling of a service, see Fault
+// - ThinkTimes: pauses before answering inputs by key, ThinkTimeAnyKey applies to other inputs, see ThinkTime
 type JobRun struct {
-	ServiceId        string    `json:"serviceId"`
-	DomainId         string    `json:"domainId"`
-	JibConfig        JibConfig `json:"jibConfig"`
-	CallbackUrl      string    `json:"callbackUrl,omitempty"`
-	OversupplyInputs bool      `json:"oversupplyInputs"`
-	HowMany          int       `json:"howMany"`
+	ServiceId        string                   `json:"serviceId"`
+	DomainId         string                   `json:"domainId"`
+	JibConfig        JibConfig                `json:"jibConfig"`
+	CallbackUrl      string                   `json:"callbackUrl,omitempty"`
+	OversupplyInputs bool                     `json:"oversupplyInputs"`
+	HowMany          int                      `json:"howMany"`
+	Expectations     []Expectation            `json:"expectations,omitempty"`
+	Label            string                   `json:"label,omitempty"`
+	Timeout          time.Duration            `json:"timeout,omitempty"`
+	InputTimeout     time.Duration            `json:"inputTimeout,omitempty"`
+	DuplicateInputs  DuplicateInputPolicy     `json:"duplicateInputs,omitempty"`
+	ValidateInputs   ValidationMode           `json:"validateInputs,omitempty"`
+	Overrides        *Overrides               `json:"overrides,omitempty"`
+	Vars             map[string]interface{}   `json:"vars,omitempty"`
+	Matrix           map[string][]interface{} `json:"matrix,omitempty"`
+	RunIndex         int                      `json:"runIndex,omitempty"`
+	UniqueData       bool                     `json:"uniqueData,omitempty"`
+	Parallelism      int                      `json:"parallelism,omitempty"`
+	Consent          *ConsentPolicy           `json:"consent,omitempty"`
+	Faults           map[string]Fault         `json:"faults,omitempty"`
+	ThinkTimes       map[string]ThinkTime     `json:"thinkTimes,omitempty"`
 }
 
 // RunJob create automation job which then will be stored in JobRunner object for further control.
 func (jr *JobRunner) RunJob(jobRun JobRun) (job cl.Job, err error) {
-	inputData, err := GenerateData(jr.JibUrl, jobRun.JibConfig, jr.httpClient)
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if len(jobRun.Matrix) > 0 {
+		return job, errors.New("job run with matrix must be expanded into separate job runs, see JobRun.Expand")
+	}
+
+	if err = jr.Safety.checkRun(jr.baseUrl, jobRun); err != nil {
+		return job, err
+	}
+
+	howMany := int(math.Max(1.0, float64(jobRun.HowMany)))
+	datasets, err := jr.generateDatasets(jobRun, howMany)
 	if err != nil {
 		return job, err
 	}
+	for _, data := range datasets {
+		if err = jr.Safety.checkCards(data); err != nil {
+			return job, err
+		}
+	}
+	inputData := datasets[0]
 	jr.InputData = inputData
 	jr.DomainId = jobRun.DomainId
+	jr.Expectations = jobRun.Expectations
+	jr.JobRun = jobRun
+	jr.Events = nil
+	jr.Job = nil
+
+	for _, data := range datasets {
+		if err = jr.validateInputs(data); err != nil {
+			return job, err
+		}
+	}
+	jr.Jobs = unfinished(jr.Jobs)
 
 	jcr := cl.JobCreationRequest{
 		ServiceId:   jobRun.ServiceId,
@@ -72,26 +162,64 @@ func (jr *JobRunner) RunJob(jobRun JobRun) (job cl.Job, err error) {
 		}
 	*/
 
-	for i := 0; i < int(math.Max(1.0, float64(jobRun.HowMany))); i++ {
+	for i := 0; i < howMany; i++ {
+		data := datasets[i%len(datasets)]
+		jcr.Data = data
 		job, err = jr.apiClient.CreateJob(jcr)
 		if err != nil {
 			return job, err
 		}
-		// TODO: make working with multiple jobs
-		jr.Job = &job
+		jr.Job = jr.track(job)
+		state := jr.states[job.Id]
+		state.inputData = data
+		state.jobIndex = i
+		state.domainId = jobRun.DomainId
+		jr.InputData = data
+		jr.record(Event{Type: EventJobCreated, Data: data})
 	}
 
 	return job, err
 }
 
-// ResumeJob initializes jobrunner instance with running job.
+// ResumeJob initializes jobrunner instance with running job,
+// input data stashed for a job created by the runner becomes InputData again.
 func (jr *JobRunner) ResumeJob(jobId, domainId string) (err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
 	job, err := jr.apiClient.FetchJob(jobId)
 	jr.DomainId = domainId
 	jr.Job = &job
+	if err == nil {
+		jr.Job = jr.track(job)
+		state := jr.states[job.Id]
+		state.domainId = domainId
+		if state.inputData != nil {
+			jr.InputData = state.inputData
+		}
+	}
 	return
 }
 
+// CurrentJob returns a copy of current job, second result is false when no job was created or resumed.
+func (jr *JobRunner) CurrentJob() (job cl.Job, ok bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if jr.Job == nil {
+		return job, false
+	}
+	return *jr.Job, true
+}
+
+// Timeline returns a copy of recorded events.
+func (jr *JobRunner) Timeline() []Event {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	return append([]Event(nil), jr.Events...)
+}
+
 func makeCallbackUrl(url, domainId string) string {
 	if url == "" {
 		return ""
@@ -113,17 +241,17 @@ func filterInputs(d cl.Domain, i map[string]interface{}) (result map[string]inte
 }
 */
 
-func getFromOutput(job *cl.Job, key string, method string) (data interface{}, err error) {
-	output, err := job.GetOutput(key)
+func (jr *JobRunner) getFromOutput(key string, method string) (data interface{}, err error) {
+	output, err := jr.fetchOutput(key)
 	if err != nil {
 		return
 	}
 
 	switch method {
 	case "Consent":
-		return output.Data, nil
+		return output, nil
 	case "SelectOne":
-		arr := output.Data.([]interface{})
+		arr := output.([]interface{})
 		return arr[0], nil
 	}
 
@@ -133,43 +261,159 @@ func getFromOutput(job *cl.Job, key string, method string) (data interface{}, er
 // CreateInput makes an attempt to create input automatically.
 // It uses job output and domain type definitions in order to do so.
 // For example, it can send "finalPriceConsent" based on "finalPrice" output, if domain
-// defines "finalPriceConsent" input with "finalPrice" as `sourceOutputKey` and "Consent" and `inputMethod`
+// defines "finalPriceConsent" input with "finalPrice" as `sourceOutputKey` and "Consent" and `inputMethod`.
+// Input is answered after a pause configured by JobRun.ThinkTimes, runner is not locked during the pause.
 func (jr *JobRunner) CreateInput() (err error) {
-	var data interface{}
-	var ok bool
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	for {
+		pause, err := jr.think()
+		if err != nil {
+			return err
+		}
+		if pause <= 0 {
+			return jr.createInput()
+		}
+
+		jr.mu.Unlock()
+		timeSleep(pause)
+		jr.mu.Lock()
 
+		// job may have changed meanwhile, so input is created from scratch
+		if jr.Job != nil {
+			if err = jr.fetch(jr.Job); err != nil {
+				return err
+			}
+			if jr.Job.State != "awaitingInput" {
+				return nil
+			}
+		}
+	}
+}
+
+func (jr *JobRunner) createInput() (err error) {
 	if jr.Job == nil {
 		return errors.New("job runner is not ready to create input: no job created or resumed")
 	}
 
-	if jr.InputData != nil {
-		data, ok = jr.InputData[jr.Job.AwaitingInputKey]
-		if ok {
-			_, err = jr.Job.CreateInput(data)
+	if err = jr.enforceLimits(jr.Job); err != nil {
+		return err
+	}
+
+	var data interface{}
+	key := jr.Job.AwaitingInputKey
+	if fault, ok := jr.JobRun.Faults[key]; ok {
+		if done, err := jr.injectFault(fault); done || err != nil {
 			return err
 		}
 	}
 
-	return jr.createInputUsingOutput()
-
-}
+	if previous, answered := jr.answeredInput(); answered {
+		data, err = jr.duplicateInput(previous)
+		if err == errSkipInput {
+			jr.record(Event{Type: EventInputDuplicate, Key: key, Message: "skipped: " + err.Error()})
+			return nil
+		}
+		if _, ok := err.(DuplicateInputError); ok {
+			jr.record(Event{Type: EventInputDuplicate, Key: key, Message: err.Error()})
+			return err
+		}
+	} else {
+		data, err = jr.resolveInput()
+	}
 
-func (jr *JobRunner) createInputUsingOutput() (err error) {
-	var prot *cl.Protocol
-	var data interface{}
-	prot, err = jr.apiClient.GetProtocol()
 	if err != nil {
+		jr.record(Event{Type: EventInputUnresolved, Key: key, Message: err.Error()})
 		return err
 	}
-	inputDef, found := prot.Domains[jr.DomainId].Inputs[jr.Job.AwaitingInputKey]
-	if !found || inputDef.SourceOutputKey == "" || inputDef.InputMethod == "" {
-		return errors.New("unexpected awaitingInputKey " + jr.Job.AwaitingInputKey)
+
+	if err = jr.validateInput(key, data); err != nil {
+		return err
+	}
+	if err = jr.checkConsent(data); err != nil {
+		if consentErr, declined := err.(ConsentError); declined {
+			return jr.decline(consentErr, data)
+		}
+		return err
 	}
 
-	data, err = getFromOutput(jr.Job, inputDef.SourceOutputKey, inputDef.InputMethod)
+	_, err = jr.Job.CreateInput(data)
 	if err != nil {
+		jr.record(Event{Type: EventInputFailed, Key: key, Data: data, Message: err.Error()})
 		return err
 	}
-	_, err = jr.Job.CreateInput(data)
-	return err
+
+	jr.markAnswered(data)
+	jr.record(Event{Type: EventInputSent, Key: key, Data: data})
+	return nil
+}
+
+// SendInput sends given data as input key of current job, e.g. from helpers generated by jobrunner-gen.
+// Unlike CreateInput it does not look for data and may send input job does not await yet.
+func (jr *JobRunner) SendInput(key string, data interface{}) (err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if jr.Job == nil {
+		return errors.New("job runner is not ready to send input: no job created or resumed")
+	}
+
+	if err = jr.validateInput(key, data); err != nil {
+		return err
+	}
+
+	var stage string
+	if key == jr.Job.AwaitingInputKey {
+		stage = jr.Job.AwaitingInputStage
+	}
+	payload := map[string]interface{}{"key": key, "data": data}
+	if stage != "" {
+		payload["stage"] = stage
+	}
+	if err = jr.apiRequest("POST", "/jobs/"+jr.Job.Id+"/inputs", payload, nil); err != nil {
+		jr.record(Event{Type: EventInputFailed, Key: key, Data: data, Message: err.Error()})
+		return err
+	}
+
+	if key == jr.Job.AwaitingInputKey {
+		jr.markAnswered(data)
+	}
+	jr.record(Event{Type: EventInputSent, Key: key, Data: data})
+	return nil
+}
+
+// resolveInput finds data for awaited input in stashed input data or derives it from job outputs,
+// jr.Resolvers are asked when neither works.
+func (jr *JobRunner) resolveInput() (data interface{}, err error) {
+	if stash := jr.stash(); stash != nil {
+		data, ok := stash[jr.Job.AwaitingInputKey]
+		if ok {
+			return data, nil
+		}
+	}
+
+	data, err = jr.deriveInput()
+	if err == nil {
+		return data, nil
+	}
+
+	resolved, resolverErr := jr.resolveWithResolvers()
+	if resolverErr == ErrUnresolved {
+		return nil, err
+	}
+	return resolved, resolverErr
+}
+
+func (jr *JobRunner) inputFromOutput() (data interface{}, err error) {
+	prot, err := jr.apiClient.GetProtocol()
+	if err != nil {
+		return nil, err
+	}
+	inputDef, found := prot.Domains[jr.DomainId].Inputs[jr.Job.AwaitingInputKey]
+	if !found || inputDef.SourceOutputKey == "" || inputDef.InputMethod == "" {
+		return nil, errors.New("unexpected awaitingInputKey " + jr.Job.AwaitingInputKey)
+	}
+
+	return jr.getFromOutput(inputDef.SourceOutputKey, inputDef.InputMethod)
 }
@@ -2,9 +2,12 @@ package jobrunner
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	cl "github.com/automationcloud/client-go"
@@ -355,13 +358,13 @@ func TestGetFromOutput(t *testing.T) {
 		jr := NewRunner(client, "apikey", "http://api", "http://jib")
 		jr.ResumeJob("id", "DomainId")
 
-		data, err := getFromOutput(jr.Job, "output-key", "Consent")
+		data, err := jr.getFromOutput("output-key", "Consent")
 
 		if err != nil {
 			t.Error(err)
 		}
 
-		if data.(float64) != 13 {
+		if data.(json.Number) != "13" {
 			t.Errorf("expected output 13, got %v", data)
 		}
 	})
@@ -383,13 +386,13 @@ func TestGetFromOutput(t *testing.T) {
 			t.FailNow()
 		}
 
-		data, err := getFromOutput(jr.Job, "output-key", "SelectOne")
+		data, err := jr.getFromOutput("output-key", "SelectOne")
 
 		if err != nil {
 			t.Error(err)
 		}
 
-		if data.(float64) != 13 {
+		if data.(json.Number) != "13" {
 			t.Errorf("expected output 13, got %v", data)
 		}
 	})
@@ -411,7 +414,7 @@ func TestGetFromOutput(t *testing.T) {
 			t.FailNow()
 		}
 
-		_, err = getFromOutput(jr.Job, "output-key", "UnknownInputMethod")
+		_, err = jr.getFromOutput("output-key", "UnknownInputMethod")
 		expectError(t, "unknown input method: UnknownInputMethod", err)
 	})
 
@@ -438,7 +441,7 @@ func TestGetFromOutput(t *testing.T) {
 		}
 
 		fmt.Println(jr.Job)
-		_, err = getFromOutput(jr.Job, ":key", "SelectOne")
+		_, err = jr.getFromOutput(":key", "SelectOne")
 
 		expectError(t, "server error", err)
 	})
@@ -458,3 +461,74 @@ func newTestClient(fn rtf) *http.Client {
 		Transport: rtf(fn),
 	}
 }
+
+func TestConcurrentUse(t *testing.T) {
+	responses := map[string]string{
+		"GET http://api/jobs/job-id": `{
+			"id": "job-id",
+			"state": "awaitingInput",
+			"awaitingInputKey": "finalPriceConsent"
+		}`,
+		"POST http://api/jobs/job-id/inputs": `{"id": "input-id"}`,
+	}
+	var inputsCreated int32
+	client := newTestClient(func(req *http.Request) *http.Response {
+		request := req.Method + " " + req.URL.String()
+		response, ok := responses[request]
+		if !ok {
+			panic("undeclared request: " + request)
+		}
+		if req.Method == "POST" {
+			atomic.AddInt32(&inputsCreated, 1)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(response)),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.InputData = map[string]interface{}{"finalPriceConsent": 13}
+	if err := jr.ResumeJob("job-id", "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			errs <- jr.CreateInput()
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- jr.ResumeJob("job-id", "A")
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- jr.Refresh()
+			jr.CurrentJob()
+			jr.Timeline()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if len(jr.Timeline()) != 10 {
+		t.Errorf("expected 10 events, got %d", len(jr.Timeline()))
+	}
+	if inputsCreated != 1 {
+		t.Errorf("expected input to be sent once, got %d", inputsCreated)
+	}
+	if job, ok := jr.CurrentJob(); !ok || job.Id != "job-id" {
+		t.Errorf("unexpected current job %v", job)
+	}
+}
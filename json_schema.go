@@ -0,0 +1,411 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SchemaViolation describes a single mismatch between data and JSON Schema.
+// Path points to the offending value and SchemaPath to the keyword which rejected it,
+// both are JSON pointers.
+type SchemaViolation struct {
+	Path       string `json:"path"`
+	SchemaPath string `json:"schemaPath"`
+	Message    string `json:"message"`
+}
+
+// String makes human-readable representation of a violation.
+func (v SchemaViolation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + v.Message + " (schema " + v.SchemaPath + ")"
+}
+
+// ValidateSchema checks data against a subset of JSON Schema (draft 7) keywords:
+// type, enum, const, required, properties, additionalProperties, items,
+// minItems, maxItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// minLength, maxLength, pattern, allOf, anyOf, oneOf and $ref.
+// It returns all violations found, empty result means data is valid.
+// References ("$ref") are resolved as JSON pointers within schema itself.
+func ValidateSchema(schema map[string]interface{}, data interface{}) []SchemaViolation {
+	v := schemaValidator{resolve: pointerResolver(schema)}
+	return v.validate(schema, data, "", "#")
+}
+
+// schemaResolver finds schema referenced by "$ref" or "typeRef" of given schema,
+// it returns referenced schema along with its location.
+type schemaResolver func(schema map[string]interface{}) (resolved map[string]interface{}, schemaPath string, ok bool)
+
+// pointerResolver resolves "$ref" containing JSON pointer (e.g. "#/definitions/Passenger") within root document.
+func pointerResolver(root interface{}) schemaResolver {
+	return func(schema map[string]interface{}) (map[string]interface{}, string, bool) {
+		ref, _ := schema["$ref"].(string)
+		if !strings.HasPrefix(ref, "#") {
+			return nil, "", false
+		}
+		resolved, ok := resolvePointer(root, strings.TrimPrefix(ref, "#"))
+		s, isSchema := resolved.(map[string]interface{})
+		return s, ref, ok && isSchema
+	}
+}
+
+// resolvePointer finds value in json document by JSON pointer (RFC 6901), empty pointer refers to document itself.
+func resolvePointer(doc interface{}, pointer string) (interface{}, bool) {
+	tokens, ok := pointerTokens(pointer)
+	if !ok {
+		return nil, false
+	}
+
+	current := doc
+	for _, token := range tokens {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, ok := c[token]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// pointerTokens splits JSON pointer into unescaped reference tokens, second result is false for malformed pointer.
+func pointerTokens(pointer string) ([]string, bool) {
+	if pointer == "" {
+		return nil, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, true
+}
+
+type schemaValidator struct {
+	resolve schemaResolver
+	// sensitive tells whether value at JSON pointer must not appear in messages, it returns mask shown instead.
+	sensitive func(path string) (mask string, ok bool)
+}
+
+// show formats offending value for a violation message, sensitive values are masked.
+func (v schemaValidator) show(path string, data interface{}) string {
+	if v.sensitive != nil {
+		if mask, ok := v.sensitive(path); ok {
+			return mask
+		}
+	}
+	return toJSON(data)
+}
+
+func (v schemaValidator) validate(schema map[string]interface{}, data interface{}, path, schemaPath string) (violations []SchemaViolation) {
+	if v.resolve != nil {
+		if resolved, refPath, ok := v.resolve(schema); ok {
+			return v.validate(resolved, data, path, refPath)
+		}
+	}
+
+	fail := func(keyword, format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{
+			Path:       path,
+			SchemaPath: schemaPath + "/" + keyword,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, data) {
+		fail("type", "expected %v, got %s", t, jsonType(data))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, data) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "value %s is not one of %s", v.show(path, data), toJSON(enum))
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !jsonEqual(c, data) {
+		fail("const", "expected %s, got %s", toJSON(c), v.show(path, data))
+	}
+
+	for i, sub := range schemaList(schema["allOf"]) {
+		violations = append(violations, v.validate(sub, data, path, schemaPath+"/allOf/"+strconv.Itoa(i))...)
+	}
+
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 {
+		matched := 0
+		for i, sub := range anyOf {
+			if len(v.validate(sub, data, path, schemaPath+"/anyOf/"+strconv.Itoa(i))) == 0 {
+				matched++
+			}
+		}
+		if matched == 0 {
+			fail("anyOf", "value does not match any schema")
+		}
+	}
+
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 {
+		matched := 0
+		for i, sub := range oneOf {
+			if len(v.validate(sub, data, path, schemaPath+"/oneOf/"+strconv.Itoa(i))) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("oneOf", "value matches %d schemas, expected exactly one", matched)
+		}
+	}
+
+	switch d := data.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				key, _ := r.(string)
+				if _, present := d[key]; !present {
+					fail("required", "missing required property %q", key)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		for key, value := range d {
+			if propSchema, ok := props[key].(map[string]interface{}); ok {
+				violations = append(violations, v.validate(propSchema, value, path+"/"+escapePointer(key), schemaPath+"/properties/"+escapePointer(key))...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("additionalProperties", "unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				violations = append(violations, v.validate(additional, value, path+"/"+escapePointer(key), schemaPath+"/additionalProperties")...)
+			}
+		}
+	case []interface{}:
+		if min, ok := toFloat(schema["minItems"]); ok && float64(len(d)) < min {
+			fail("minItems", "expected at least %v items, got %d", min, len(d))
+		}
+		if max, ok := toFloat(schema["maxItems"]); ok && float64(len(d)) > max {
+			fail("maxItems", "expected at most %v items, got %d", max, len(d))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range d {
+				violations = append(violations, v.validate(items, item, path+"/"+strconv.Itoa(i), schemaPath+"/items")...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(d)))
+		if min, ok := toFloat(schema["minLength"]); ok && length < min {
+			fail("minLength", "expected at least %v characters, got %v", min, length)
+		}
+		if max, ok := toFloat(schema["maxLength"]); ok && length > max {
+			fail("maxLength", "expected at most %v characters, got %v", max, length)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fail("pattern", "invalid pattern %q: %v", pattern, err)
+			} else if !re.MatchString(d) {
+				fail("pattern", "value %s does not match %q", v.show(path, d), pattern)
+			}
+		}
+	}
+
+	if n, ok := toFloat(data); ok && isNumber(data) {
+		if min, ok := toFloat(schema["minimum"]); ok && n < min {
+			fail("minimum", "expected value >= %v, got %s", min, v.show(path, data))
+		}
+		if max, ok := toFloat(schema["maximum"]); ok && n > max {
+			fail("maximum", "expected value <= %v, got %s", max, v.show(path, data))
+		}
+		if min, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= min {
+			fail("exclusiveMinimum", "expected value > %v, got %s", min, v.show(path, data))
+		}
+		if max, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= max {
+			fail("exclusiveMaximum", "expected value < %v, got %s", max, v.show(path, data))
+		}
+	}
+
+	return
+}
+
+func schemaList(v interface{}) (list []map[string]interface{}) {
+	arr, _ := v.([]interface{})
+	for _, item := range arr {
+		if s, ok := item.(map[string]interface{}); ok {
+			list = append(list, s)
+		}
+	}
+	return
+}
+
+func matchesType(t interface{}, data interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(data)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, item := range t {
+			if matchesType(item, data) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// jsonType returns JSON Schema type name of decoded json value.
+func jsonType(data interface{}) string {
+	switch data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if r, ok := toRat(data); ok && isNumber(data) {
+		if r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	}
+	return reflect.TypeOf(data).String()
+}
+
+func isNumber(data interface{}) bool {
+	switch data.(type) {
+	case json.Number, float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// toFloat converts numeric value to float64, second result is false for non-numeric values.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two values as they would look after json round trip, numbers are compared exactly.
+func jsonEqual(a, b interface{}) bool {
+	return equalNormalized(normalizeJSON(a), normalizeJSON(b))
+}
+
+func equalNormalized(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, v := range a {
+			bv, ok := bm[k]
+			if !ok || !equalNormalized(v, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bs, ok := b.([]interface{})
+		if !ok || len(a) != len(bs) {
+			return false
+		}
+		for i := range a {
+			if !equalNormalized(a[i], bs[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		return numbersEqual(a, b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// normalizeJSON converts value into generic json representation (maps, slices, json.Number),
+// so values of different go types can be compared.
+func normalizeJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var result interface{}
+	if err := decodeJSON(b, &result); err != nil {
+		return v
+	}
+	return result
+}
+
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
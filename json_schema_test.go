@@ -0,0 +1,90 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+			"age": {"type": "integer", "minimum": 18},
+			"tags": {"type": "array", "maxItems": 1, "items": {"enum": ["a", "b"]}},
+			"contact": {"oneOf": [{"type": "string"}, {"type": "null"}]}
+		}
+	}`), &schema)
+
+	t.Run("valid", func(t *testing.T) {
+		var data interface{}
+		json.Unmarshal([]byte(`{"name": "Bob", "age": 30, "tags": ["a"], "contact": null}`), &data)
+		if violations := ValidateSchema(schema, data); len(violations) != 0 {
+			t.Errorf("expected no violations, got %v", violations)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var data interface{}
+		json.Unmarshal([]byte(`{"name": "b", "age": 17.5, "tags": ["c", "a"], "extra": 1}`), &data)
+		violations := ValidateSchema(schema, data)
+		expected := map[string]string{
+			"#/properties/name/minLength":  "/name",
+			"#/properties/name/pattern":    "/name",
+			"#/properties/age/type":        "/age",
+			"#/properties/tags/maxItems":   "/tags",
+			"#/properties/tags/items/enum": "/tags/0",
+			"#/additionalProperties":       "",
+		}
+		if len(violations) != len(expected) {
+			t.Fatalf("expected %d violations, got %v", len(expected), violations)
+		}
+		for _, v := range violations {
+			path, ok := expected[v.SchemaPath]
+			if !ok || path != v.Path {
+				t.Errorf("unexpected violation %v", v)
+			}
+		}
+	})
+
+	t.Run("type mismatch stops validation", func(t *testing.T) {
+		violations := ValidateSchema(schema, "string")
+		if len(violations) != 1 || violations[0].String() != "/: expected object, got string (schema #/type)" {
+			t.Errorf("unexpected violations %v", violations)
+		}
+	})
+}
+
+func TestSchemaRefs(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"type": "array",
+		"items": {"$ref": "#/definitions/Passenger"},
+		"definitions": {
+			"Passenger": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}},
+			"a/b~c": {"const": 1}
+		}
+	}`), &schema)
+
+	t.Run("resolves ref", func(t *testing.T) {
+		var data interface{}
+		json.Unmarshal([]byte(`[{"name": "Bob"}, {"name": 1}]`), &data)
+		violations := ValidateSchema(schema, data)
+		if len(violations) != 1 || violations[0].String() != "/1/name: expected string, got integer (schema #/definitions/Passenger/properties/name/type)" {
+			t.Errorf("unexpected violations %v", violations)
+		}
+	})
+
+	t.Run("resolves escaped pointer", func(t *testing.T) {
+		value, ok := resolvePointer(schema, "/definitions/a~1b~0c/const")
+		if !ok || value != 1.0 {
+			t.Errorf("expected value to be resolved, got %v", value)
+		}
+		if _, ok := resolvePointer(schema, "/items/0"); ok {
+			t.Errorf("expected pointer not to be resolved")
+		}
+	})
+}
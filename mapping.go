@@ -0,0 +1,422 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MappingRule derives input from job output when protocol does not link them, e.g. fare id chosen from available fares:
+//
+//	MappingRule{
+//		InputKey:   "selectedFareId",
+//		OutputKey:  "availableFares",
+//		Expression: `$[?(@.cabin == "economy")].id | first`,
+//	}
+//
+// Expression is a JSONPath applied to output data followed by optional functions separated by "|".
+// Supported JSONPath syntax is "$" (output data), ".name" and "['name']" (object property),
+// "[0]" (array item, negative index counts from the end), ".*" and "[*]" (all items) and
+// "[?(@.path op value)]" (items matching a filter, op is one of ==, !=, <, <=, >, >=, value is a json literal
+// or single-quoted string, "[?(@.path)]" matches items having path). Path yields a list when it contains
+// a wildcard or a filter and a single value otherwise.
+// Functions are first, last, count, sum, min, max (of numbers) and minBy(path), maxBy(path) (item with
+// the lowest or highest number at dot-separated path). Empty expression sends output data as is.
+// Mapped data of Consent inputs is checked by JobRun.Consent policy like data derived from protocol.
+type MappingRule struct {
+	// Domain limits rule to jobs of a domain, rule applies to any domain when empty.
+	Domain     string `json:"domain,omitempty"`
+	InputKey   string `json:"inputKey"`
+	OutputKey  string `json:"outputKey"`
+	Expression string `json:"expression,omitempty"`
+}
+
+// errNoMapping is returned by inputFromMapping when no rule maps awaited input.
+var errNoMapping = errors.New("no mapping rule")
+
+// inputFromMapping derives data for awaited input using the first of jr.Mappings matching domain and input key.
+func (jr *JobRunner) inputFromMapping() (data interface{}, err error) {
+	for _, rule := range jr.Mappings {
+		if rule.InputKey != jr.Job.AwaitingInputKey || (rule.Domain != "" && rule.Domain != jr.DomainId) {
+			continue
+		}
+
+		output, err := jr.fetchOutput(rule.OutputKey)
+		if err == nil {
+			data, err = EvaluateExpression(rule.Expression, output)
+		}
+		if err != nil {
+			return nil, errors.New("mapping of input " + rule.InputKey + " from output " + rule.OutputKey + " failed: " + err.Error())
+		}
+		return data, nil
+	}
+	return nil, errNoMapping
+}
+
+// deriveInput derives data for awaited input from job outputs using jr.Mappings, or protocol definitions when no rule applies.
+func (jr *JobRunner) deriveInput() (data interface{}, err error) {
+	if data, err = jr.inputFromMapping(); err != errNoMapping {
+		return data, err
+	}
+	return jr.inputFromOutput()
+}
+
+// EvaluateExpression applies mapping expression to data, see MappingRule.
+func EvaluateExpression(expression string, data interface{}) (interface{}, error) {
+	parts := splitOutsideQuotes(expression, '|')
+	path := strings.TrimSpace(parts[0])
+	if path == "" {
+		path = "$"
+	}
+
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evaluateJSONPath(steps, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, call := range parts[1:] {
+		if result, err = applyFunction(strings.TrimSpace(call), result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+type pathStepKind int
+
+const (
+	stepField pathStepKind = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+type pathStep struct {
+	kind   pathStepKind
+	field  string
+	index  int
+	filter pathFilter
+}
+
+// pathFilter matches items which have value at dot-separated path, compared with value when op is set.
+type pathFilter struct {
+	path  string
+	op    string
+	value interface{}
+}
+
+var filterPattern = regexp.MustCompile(`^@((?:\.[^.\s=!<>]+)*)\s*(?:(==|!=|<=|>=|<|>)\s*(.+))?$`)
+
+func parseJSONPath(path string) (steps []pathStep, err error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New("expression " + path + " must start with $")
+	}
+
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid expression %s: %s", path, reason)
+	}
+
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, invalid("recursive descent is not supported")
+		case strings.HasPrefix(rest, ".*"):
+			steps = append(steps, pathStep{kind: stepWildcard})
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, invalid("empty property name")
+			}
+			steps = append(steps, pathStep{kind: stepField, field: name})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "[?("):
+			end := indexOutsideQuotes(rest, ")]")
+			if end < 0 {
+				return nil, invalid("unterminated filter")
+			}
+			filter, err := parseFilter(strings.TrimSpace(rest[3:end]))
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			steps = append(steps, pathStep{kind: stepFilter, filter: filter})
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "[*]"):
+			steps = append(steps, pathStep{kind: stepWildcard})
+			rest = rest[3:]
+		case strings.HasPrefix(rest, "['"), strings.HasPrefix(rest, `["`):
+			end := indexOutsideQuotes(rest, "]")
+			if end < 0 {
+				return nil, invalid("unterminated property name")
+			}
+			name, err := parseLiteral(rest[1:end])
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			steps = append(steps, pathStep{kind: stepField, field: fmt.Sprint(name)})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, invalid("unterminated index")
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, invalid("index " + rest[1:end] + " is not a number")
+			}
+			steps = append(steps, pathStep{kind: stepIndex, index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, invalid("unexpected " + rest)
+		}
+	}
+	return steps, nil
+}
+
+func parseFilter(condition string) (f pathFilter, err error) {
+	m := filterPattern.FindStringSubmatch(condition)
+	if m == nil {
+		return f, errors.New("filter " + condition + " is not supported")
+	}
+
+	f.path = strings.TrimPrefix(m[1], ".")
+	f.op = m[2]
+	if f.op != "" {
+		f.value, err = parseLiteral(strings.TrimSpace(m[3]))
+	}
+	return f, err
+}
+
+// parseLiteral parses json literal, single-quoted strings are accepted as well.
+func parseLiteral(literal string) (value interface{}, err error) {
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return literal[1 : len(literal)-1], nil
+	}
+	if err = decodeJSON([]byte(literal), &value); err != nil {
+		return nil, errors.New("value " + literal + " is not a json literal")
+	}
+	return value, nil
+}
+
+func evaluateJSONPath(steps []pathStep, data interface{}) (interface{}, error) {
+	nodes := []interface{}{normalizeJSON(data)}
+	definite := true
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			switch step.kind {
+			case stepField:
+				if m, ok := node.(map[string]interface{}); ok {
+					if value, ok := m[step.field]; ok {
+						next = append(next, value)
+					}
+				}
+			case stepIndex:
+				if a, ok := node.([]interface{}); ok {
+					i := step.index
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					}
+				}
+			case stepWildcard, stepFilter:
+				definite = false
+				for _, item := range children(node) {
+					if step.kind == stepWildcard || step.filter.match(item) {
+						next = append(next, item)
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+
+	if !definite {
+		if nodes == nil {
+			nodes = []interface{}{}
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("expression matched nothing")
+	}
+	return nodes[0], nil
+}
+
+// children lists array items or object values ordered by keys.
+func children(node interface{}) []interface{} {
+	switch n := node.(type) {
+	case []interface{}:
+		return n
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		for i, k := range keys {
+			values[i] = n[k]
+		}
+		return values
+	}
+	return nil
+}
+
+func (f pathFilter) match(item interface{}) bool {
+	value, found := lookupPath(item, f.path)
+	if !found {
+		return false
+	}
+
+	switch f.op {
+	case "":
+		return true
+	case "==":
+		return jsonEqual(value, f.value)
+	case "!=":
+		return !jsonEqual(value, f.value)
+	}
+
+	cmp, ok := compareValues(value, f.value)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// compareValues orders two numbers or two strings, second result is false for other values.
+func compareValues(a, b interface{}) (int, bool) {
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		return strings.Compare(sa, sb), ok
+	}
+	if !isNumber(a) || !isNumber(b) {
+		return 0, false
+	}
+	ra, aok := toRat(a)
+	rb, bok := toRat(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return ra.Cmp(rb), true
+}
+
+func applyFunction(call string, value interface{}) (interface{}, error) {
+	name, arg := call, ""
+	if open := strings.Index(call, "("); open >= 0 && strings.HasSuffix(call, ")") {
+		name, arg = call[:open], strings.TrimSpace(call[open+1:len(call)-1])
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("function %s expects a list, got %s", name, toJSON(value))
+	}
+
+	switch name {
+	case "first", "last":
+		if len(items) == 0 {
+			return nil, errors.New("expression matched nothing")
+		}
+		if name == "first" {
+			return items[0], nil
+		}
+		return items[len(items)-1], nil
+	case "count":
+		return json.Number(strconv.Itoa(len(items))), nil
+	case "sum":
+		sum, _ := toRat(0)
+		for _, item := range items {
+			r, ok := toRat(item)
+			if !ok || !isNumber(item) {
+				return nil, fmt.Errorf("function sum expects numbers, got %s", toJSON(item))
+			}
+			sum.Add(sum, r)
+		}
+		return json.Number(strings.TrimSuffix(strings.TrimRight(sum.FloatString(10), "0"), ".")), nil
+	case "min", "max", "minBy", "maxBy":
+		if (name == "minBy" || name == "maxBy") == (arg == "") {
+			return nil, errors.New("function " + call + " is called with wrong arguments")
+		}
+		var best, bestValue interface{}
+		for _, item := range items {
+			v, found := lookupPath(item, arg)
+			if !found || !isNumber(v) {
+				return nil, fmt.Errorf("function %s expects numbers, got %s", call, toJSON(item))
+			}
+			cmp, _ := compareValues(v, bestValue)
+			if best == nil || (strings.HasPrefix(name, "min") && cmp < 0) || (strings.HasPrefix(name, "max") && cmp > 0) {
+				best, bestValue = item, v
+			}
+		}
+		if best == nil {
+			return nil, errors.New("expression matched nothing")
+		}
+		if arg == "" {
+			return bestValue, nil
+		}
+		return best, nil
+	}
+	return nil, errors.New("unknown function " + call)
+}
+
+// splitOutsideQuotes splits s by sep which is not inside of single or double quotes.
+func splitOutsideQuotes(s string, sep byte) (parts []string) {
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// indexOutsideQuotes finds substr which is not inside of single or double quotes.
+func indexOutsideQuotes(s, substr string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(s[i:], substr):
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,168 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	var fares interface{}
+	decodeJSON([]byte(`{"fares": [
+		{"id": "f1", "cabin": "business", "price": {"value": 900.50}},
+		{"id": "f2", "cabin": "economy", "price": {"value": 120.10}, "refundable": true},
+		{"id": "f3", "cabin": "economy", "price": {"value": 99.90}},
+		{"id": "f4", "cabin": "premium economy", "price": {"value": 300}}
+	], "currency": "gbp", "odd key": 1}`), &fares)
+
+	cases := []struct{ expression, expected string }{
+		{"", `{"currency":"gbp","fares":[{"cabin":"business","id":"f1","price":{"value":900.50}},{"cabin":"economy","id":"f2","price":{"value":120.10},"refundable":true},{"cabin":"economy","id":"f3","price":{"value":99.90}},{"cabin":"premium economy","id":"f4","price":{"value":300}}],"odd key":1}`},
+		{"$.currency", `"gbp"`},
+		{"$['odd key']", `1`},
+		{"$.fares[1].id", `"f2"`},
+		{"$.fares[-1].id", `"f4"`},
+		{"$.fares[*].id", `["f1","f2","f3","f4"]`},
+		{"$.fares.*.cabin | first", `"business"`},
+		{`$.fares[?(@.cabin == "economy")].id | first`, `"f2"`},
+		{`$.fares[?(@.cabin == 'economy')].id | last`, `"f3"`},
+		{`$.fares[?(@.cabin != "economy")].id`, `["f1","f4"]`},
+		{`$.fares[?(@.price.value < 150)].id`, `["f2","f3"]`},
+		{`$.fares[?(@.price.value >= 300)].id | count`, `2`},
+		{`$.fares[?(@.cabin > "economy")].id`, `["f4"]`},
+		{`$.fares[?(@.refundable)].id`, `["f2"]`},
+		{`$.fares[?(@.cabin == "first")].id`, `[]`},
+		{`$.fares[?(@.cabin == "economy")] | minBy(price.value) | first`, ``},
+		{`$.fares[?(@.cabin == "economy")] | minBy(price.value)`, `{"cabin":"economy","id":"f3","price":{"value":99.90}}`},
+		{`$.fares | maxBy(price.value)`, `{"cabin":"business","id":"f1","price":{"value":900.50}}`},
+		{`$.fares[*].price.value | min`, `99.90`},
+		{`$.fares[*].price.value | max`, `900.50`},
+		{`$.fares[*].price.value | sum`, `1420.5`},
+		{`$.fares[?(@.id == "a|b")].id`, `[]`},
+	}
+	for _, c := range cases {
+		result, err := EvaluateExpression(c.expression, fares)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("expected %s to fail, got %s", c.expression, toJSON(result))
+			}
+			continue
+		}
+		if err != nil || toJSON(result) != c.expected {
+			t.Errorf("expected %s to be %s, got %s, %v", c.expression, c.expected, toJSON(result), err)
+		}
+	}
+
+	errorCases := map[string]string{
+		"fares":                               "expression fares must start with $",
+		"$..id":                               "invalid expression $..id: recursive descent is not supported",
+		"$.fares[x]":                          "invalid expression $.fares[x]: index x is not a number",
+		"$.fares[?(@.id ~ 'a')]":              "invalid expression $.fares[?(@.id ~ 'a')]: filter @.id ~ 'a' is not supported",
+		"$.fares[?(@.id == economy)]":         "invalid expression $.fares[?(@.id == economy)]: value economy is not a json literal",
+		"$.fares[?(@.id == 'f1')":             "invalid expression $.fares[?(@.id == 'f1'): unterminated filter",
+		"$.missing":                           "expression matched nothing",
+		"$.fares[?(@.id == 'x')] | first":     "expression matched nothing",
+		"$.fares | avg":                       "unknown function avg",
+		"$.currency | first":                  `function first expects a list, got "gbp"`,
+		"$.fares[*].id | max":                 `function max expects numbers, got "f1"`,
+		"$.fares | minBy()":                   "function minBy() is called with wrong arguments",
+		"$.fares[*].price.value | min(value)": "function min(value) is called with wrong arguments",
+	}
+	for expression, message := range errorCases {
+		_, err := EvaluateExpression(expression, fares)
+		expectError(t, message, err)
+	}
+}
+
+func TestMappingRules(t *testing.T) {
+	var sent []string
+	awaitingKey := "selectedFareId"
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		status := 200
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "` + awaitingKey + `"}`
+		case "GET http://api/jobs/job-id/outputs/availableFares":
+			body = `{"key": "availableFares", "data": [{"id": "f1", "cabin": "business"}, {"id": "f2", "cabin": "economy"}]}`
+		case "GET http://api/jobs/job-id/outputs/priceBreakdown":
+			body = `{"key": "priceBreakdown", "data": {"total": {"value": 600, "currencyCode": "GBP"}}}`
+		case "GET http://api/jobs/job-id/outputs/missing":
+			status = 404
+		case "GET https://protocol.automationcloud.net/schema.json":
+			body = `{"domains": {"Flight": {"inputs": {
+				"selectedFareId": {"sourceOutputKey": "availableFares", "inputMethod": "SelectOne"},
+				"finalPriceConsent": {"sourceOutputKey": "finalPrice", "inputMethod": "Consent"}
+			}}}}`
+		case "POST http://api/jobs/job-id/cancel":
+			body = `{}`
+		case "POST http://api/jobs/job-id/inputs":
+			var input struct {
+				Data interface{} `json:"data"`
+			}
+			json.NewDecoder(req.Body).Decode(&input)
+			sent = append(sent, toJSON(input.Data))
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	var consent *ConsentPolicy
+	run := func(mappings ...MappingRule) error {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.Mappings = mappings
+		jr.JobRun.Consent = consent
+		jr.ResumeJob("job-id", "Flight")
+		return jr.CreateInput()
+	}
+
+	t.Run("rule is checked before protocol", func(t *testing.T) {
+		err := run(MappingRule{
+			Domain:     "Flight",
+			InputKey:   "selectedFareId",
+			OutputKey:  "availableFares",
+			Expression: `$[?(@.cabin == "economy")].id | first`,
+		})
+		if err != nil || len(sent) != 1 || sent[0] != `"f2"` {
+			t.Errorf("expected economy fare to be sent, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("rules of other domains and inputs are skipped", func(t *testing.T) {
+		err := run(
+			MappingRule{Domain: "Hotel", InputKey: "selectedFareId", OutputKey: "missing"},
+			MappingRule{InputKey: "passengers", OutputKey: "missing"},
+		)
+		if err != nil || len(sent) != 1 || sent[0] != `{"cabin":"business","id":"f1"}` {
+			t.Errorf("expected protocol to be used, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("failed rule", func(t *testing.T) {
+		err := run(MappingRule{InputKey: "selectedFareId", OutputKey: "missing"})
+		expectError(t, "mapping of input selectedFareId from output missing failed: client error", err)
+		err = run(MappingRule{InputKey: "selectedFareId", OutputKey: "availableFares", Expression: `$[?(@.cabin == "first")] | first`})
+		expectError(t, "mapping of input selectedFareId from output availableFares failed: expression matched nothing", err)
+		if len(sent) != 0 {
+			t.Errorf("expected no input to be sent, got %v", sent)
+		}
+	})
+
+	t.Run("mapped consent is checked by policy", func(t *testing.T) {
+		awaitingKey, consent = "finalPriceConsent", &ConsentPolicy{MaxAmount: map[string]json.Number{"GBP": "500"}}
+		defer func() { awaitingKey, consent = "selectedFareId", nil }()
+		err := run(MappingRule{InputKey: "finalPriceConsent", OutputKey: "priceBreakdown", Expression: "$.total"})
+		expectError(t, "consent finalPriceConsent declined for job job-id: price 600.00 GBP exceeds maximum 500.00 GBP", err)
+		if len(sent) != 0 {
+			t.Errorf("expected consent not to be sent, got %v", sent)
+		}
+	})
+}
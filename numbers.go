@@ -0,0 +1,119 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// decodeJSON unmarshals json keeping numbers as json.Number, so exact values of prices and large ids
+// survive the round trip from jib and api back into inputs. Errors are the same json.Unmarshal reports.
+func decodeJSON(b []byte, v interface{}) error {
+	var raw json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// toRat converts numeric value to exact rational number, second result is false for non-numeric values.
+// Numeric strings are accepted as well, e.g. "12.30".
+func toRat(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(n))
+	case string:
+		return new(big.Rat).SetString(n)
+	case float32, float64:
+		f, _ := toFloat(n)
+		r := new(big.Rat)
+		if r.SetFloat64(f) == nil {
+			return nil, false
+		}
+		return r, true
+	}
+	if !isNumber(v) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(fmt.Sprint(v))
+}
+
+// Decimal converts numeric output value to exact decimal, e.g. json.Number("12.30") or "12.30".
+func Decimal(v interface{}) (*big.Rat, error) {
+	r, ok := toRat(v)
+	if !ok {
+		return nil, fmt.Errorf("expected decimal, got %s", toJSON(v))
+	}
+	return r, nil
+}
+
+// Price is a price-like output value, e.g. {"value": 123.45, "currencyCode": "gbp"}.
+type Price struct {
+	Value        *big.Rat
+	CurrencyCode string
+}
+
+// String formats price with two decimal places and currency code, e.g. "123.45 GBP".
+func (p Price) String() string {
+	return strings.TrimSpace(p.Value.FloatString(2) + " " + strings.ToUpper(p.CurrencyCode))
+}
+
+// ParsePrice reads exact value and currency code of a price-like output value.
+func ParsePrice(v interface{}) (Price, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return Price{}, fmt.Errorf("expected price object, got %s", toJSON(v))
+	}
+
+	value, err := Decimal(m["value"])
+	if err != nil {
+		return Price{}, errors.New("invalid price value: " + err.Error())
+	}
+	code, _ := m["currencyCode"].(string)
+	return Price{Value: value, CurrencyCode: code}, nil
+}
+
+// OutputDecimal loads output of current job and reads exact decimal at dot-separated path (empty for whole output).
+func (jr *JobRunner) OutputDecimal(key, path string) (*big.Rat, error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	data, err := jr.fetchOutput(key)
+	if err != nil {
+		return nil, err
+	}
+	value, found := lookupPath(data, path)
+	if !found {
+		return nil, errors.New("output " + joinPath(key, path) + " not found")
+	}
+	return Decimal(value)
+}
+
+// OutputPrice loads price-like output of current job, e.g. "finalPrice".
+func (jr *JobRunner) OutputPrice(key string) (Price, error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	data, err := jr.fetchOutput(key)
+	if err != nil {
+		return Price{}, err
+	}
+	return ParsePrice(data)
+}
+
+// numbersEqual compares two numeric values exactly, e.g. json.Number("12.30") equals 12.3.
+// Strings are never equal to numbers, even when they hold the same digits.
+func numbersEqual(a, b interface{}) bool {
+	if !isNumber(a) || !isNumber(b) {
+		return false
+	}
+	ra, aok := toRat(a)
+	rb, bok := toRat(b)
+	return aok && bok && ra.Cmp(rb) == 0
+}
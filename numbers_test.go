@@ -0,0 +1,101 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestNumberPrecision(t *testing.T) {
+	var sent []string
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			body = `{"bookingId": 9007199254740993, "amount": 12345678901234567.89}`
+		case "POST http://api/jobs":
+			body = `{"id": "job-id"}`
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "finalPriceConsent"}`
+		case "GET http://api/jobs/job-id/outputs/finalPrice":
+			body = `{"key": "finalPrice", "data": {"value": 1234567890123.10, "currencyCode": "gbp", "ids": [9007199254740995]}}`
+		case "GET https://protocol.automationcloud.net/schema.json":
+			body = `{"domains": {"Flight": {"inputs": {"finalPriceConsent": {"sourceOutputKey": "finalPrice", "inputMethod": "Consent"}}}}}`
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	t.Run("generated data", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.Redactor = NewRedactor()
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id"}); err != nil {
+			t.Fatal(err)
+		}
+		if id := jr.InputData["bookingId"]; id != json.Number("9007199254740993") {
+			t.Errorf("expected exact id, got %v", id)
+		}
+		if data := toJSON(jr.Timeline()[0].Data); data != `{"amount":12345678901234567.89,"bookingId":9007199254740993}` {
+			t.Errorf("expected exact values in timeline, got %s", data)
+		}
+	})
+
+	t.Run("input from output", func(t *testing.T) {
+		sent = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "Flight")
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"key":"finalPriceConsent","data":{"currencyCode":"gbp","ids":[9007199254740995],"value":1234567890123.10}}`
+		if len(sent) != 1 || sent[0] != expected {
+			t.Errorf("expected input %s, got %v", expected, sent)
+		}
+	})
+
+	t.Run("decimal accessors", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "Flight")
+
+		price, err := jr.OutputPrice("finalPrice")
+		if err != nil || price.String() != "1234567890123.10 GBP" {
+			t.Errorf("expected exact price, got %v, %v", price, err)
+		}
+		id, err := jr.OutputDecimal("finalPrice", "ids.0")
+		if err != nil || id.RatString() != "9007199254740995" {
+			t.Errorf("expected exact id, got %v, %v", id, err)
+		}
+		_, err = jr.OutputDecimal("finalPrice", "currencyCode")
+		expectError(t, `expected decimal, got "gbp"`, err)
+		_, err = jr.OutputDecimal("finalPrice", "missing")
+		expectError(t, "output finalPrice.missing not found", err)
+		_, err = ParsePrice([]interface{}{})
+		expectError(t, "expected price object, got []", err)
+	})
+
+	t.Run("exact comparison", func(t *testing.T) {
+		if !jsonEqual(json.Number("12.30"), 12.3) || !jsonEqual(map[string]interface{}{"a": json.Number("1e2")}, map[string]interface{}{"a": 100}) {
+			t.Errorf("expected equal numbers to match")
+		}
+		if jsonEqual(json.Number("9007199254740993"), json.Number("9007199254740992")) {
+			t.Errorf("expected large numbers to be compared exactly")
+		}
+		if jsonEqual(json.Number("12"), "12") || jsonEqual("1", json.Number("1")) {
+			t.Errorf("expected numbers not to equal strings")
+		}
+		if jsonType(json.Number("2.0")) != "integer" || jsonType(json.Number("2.5")) != "number" {
+			t.Errorf("expected json.Number types to be detected")
+		}
+	})
+}
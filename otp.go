@@ -0,0 +1,330 @@
+package jobrunner
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOTPPattern finds one-time code in a message: six digits on their own.
+const DefaultOTPPattern = `\b(\d{6})\b`
+
+// OTPClockSkew is how much earlier than job started awaiting input a message with code may be dated,
+// it covers codes sent just before job asks for them and clocks of mail server and runner differing.
+const OTPClockSkew = 30 * time.Second
+
+// OTPSource tells where one-time code of an input comes from, either TOTP secret or mailbox must be set:
+// - TOTPSecret: base32 secret of a test account as shown by authenticator apps, codes are generated by RFC 6238
+// - Digits, Period: length of TOTP codes and how long they are valid, default to 6 digits and 30 seconds
+// - Mailbox: Maildir directory (with "new" and "cur" subdirectories) or mbox file fed by test mail sink
+// - Pattern: regular expression finding code in subject or text of a message, first group is the code when present,
+// defaults to DefaultOTPPattern
+// - Recipient: only messages sent to address containing it are searched, e.g. address of a test account
+// - MaxAge: only messages younger than that are searched, age is not limited when 0
+// - Wait: how long to wait for a message with code to arrive, mailbox is checked once when 0
+type OTPSource struct {
+	TOTPSecret string        `json:"totpSecret,omitempty"`
+	Digits     int           `json:"digits,omitempty"`
+	Period     time.Duration `json:"period,omitempty"`
+	Mailbox    string        `json:"mailbox,omitempty"`
+	Pattern    string        `json:"pattern,omitempty"`
+	Recipient  string        `json:"recipient,omitempty"`
+	MaxAge     time.Duration `json:"maxAge,omitempty"`
+	Wait       time.Duration `json:"wait,omitempty"`
+}
+
+// OTPResolver provides one-time codes (e.g. for 3DS or login verification) for inputs by key,
+// other inputs are left unresolved. Runner stays locked while resolver waits for a message.
+// Codes are taken only from messages dated after job started awaiting input (less OTPClockSkew)
+// and after message of the code used for the same key last time, so codes of earlier jobs are never reused.
+func OTPResolver(sources map[string]OTPSource) InputResolver {
+	var mu sync.Mutex
+	used := make(map[string]time.Time)
+	return func(req InputRequest) (data interface{}, err error) {
+		source, ok := sources[req.Key]
+		if !ok {
+			return nil, ErrUnresolved
+		}
+
+		since := req.AwaitingSince
+		if !since.IsZero() {
+			since = since.Add(-OTPClockSkew)
+		}
+		mu.Lock()
+		if last := used[req.Key]; last.After(since) {
+			since = last
+		}
+		mu.Unlock()
+
+		code, date, err := source.code(timeNow(), since)
+		if err != nil {
+			return nil, errors.New("one-time code for input " + req.Key + ": " + err.Error())
+		}
+
+		mu.Lock()
+		if date.After(used[req.Key]) {
+			used[req.Key] = date
+		}
+		mu.Unlock()
+		return code, nil
+	}
+}
+
+// Code returns current TOTP code or code found in the newest matching message of the mailbox dated after since,
+// the later one in mailbox wins when messages have the same date. Zero since accepts messages of any date.
+func (s OTPSource) Code(now, since time.Time) (string, error) {
+	code, _, err := s.code(now, since)
+	return code, err
+}
+
+// code returns code along with date of message it was found in, date is zero for TOTP codes.
+func (s OTPSource) code(now, since time.Time) (code string, date time.Time, err error) {
+	switch {
+	case s.TOTPSecret != "":
+		code, err = TOTP(s.TOTPSecret, now, s.Digits, s.Period)
+		return code, date, err
+	case s.Mailbox != "":
+		return s.mailboxCode(now, since)
+	}
+	return "", date, errors.New("neither totp secret nor mailbox is configured")
+}
+
+// TOTP generates time-based one-time password (RFC 6238, HMAC-SHA1) from base32 secret,
+// digits and period default to 6 and 30 seconds.
+func TOTP(secret string, t time.Time, digits int, period time.Duration) (string, error) {
+	if digits <= 0 {
+		digits = 6
+	}
+	if period < time.Second {
+		period = 30 * time.Second
+	}
+
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	if padding := len(secret) % 8; padding != 0 {
+		secret += strings.Repeat("=", 8-padding)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", errors.New("invalid totp secret: " + err.Error())
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(period/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
+
+type mailMessage struct {
+	date time.Time
+	to   string
+	text string
+}
+
+// mailboxCode searches mailbox for code in messages dated after since until it is found or s.Wait passes.
+func (s OTPSource) mailboxCode(now, since time.Time) (string, time.Time, error) {
+	pattern := s.Pattern
+	if pattern == "" {
+		pattern = DefaultOTPPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", time.Time{}, errors.New("invalid pattern: " + err.Error())
+	}
+
+	deadline := timeNow().Add(s.Wait)
+	for {
+		messages, err := readMailbox(s.Mailbox)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		var newest *mailMessage
+		var code string
+		for i, m := range messages {
+			if s.Recipient != "" && !strings.Contains(strings.ToLower(m.to), strings.ToLower(s.Recipient)) {
+				continue
+			}
+			if (s.MaxAge > 0 && now.Sub(m.date) > s.MaxAge) || !m.date.After(since) {
+				continue
+			}
+			match := re.FindStringSubmatch(m.text)
+			if match == nil || (newest != nil && m.date.Before(newest.date)) {
+				continue
+			}
+			newest, code = &messages[i], match[len(match)-1]
+			if len(match) == 1 {
+				code = match[0]
+			}
+		}
+		if newest != nil {
+			return code, newest.date, nil
+		}
+
+		if !timeNow().Before(deadline) {
+			return "", time.Time{}, errors.New("no code found in " + s.Mailbox)
+		}
+		timeSleep(time.Second)
+	}
+}
+
+// readMailbox reads messages of Maildir directory or mbox file.
+func readMailbox(path string) ([]mailMessage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readMbox(path, info.ModTime())
+	}
+
+	var messages []mailMessage
+	for _, dir := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(path, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(path, dir, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := parseMessage(b, f.ModTime()); ok {
+				messages = append(messages, m)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// readMbox splits mbox file into messages on "From " lines, messages without date get modification time of the file.
+func readMbox(path string, modTime time.Time) ([]mailMessage, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []mailMessage
+	var current bytes.Buffer
+	flush := func() {
+		if current.Len() > 0 {
+			if m, ok := parseMessage(current.Bytes(), modTime); ok {
+				messages = append(messages, m)
+			}
+			current.Reset()
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), len(b)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "From ") {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, ">From ") {
+			line = line[1:]
+		}
+		current.WriteString(line + "\n")
+	}
+	flush()
+	return messages, scanner.Err()
+}
+
+// parseMessage extracts date, recipient and searchable text (subject and decoded body) of a message.
+func parseMessage(b []byte, fallbackDate time.Time) (m mailMessage, ok bool) {
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		return m, false
+	}
+
+	body, _ := ioutil.ReadAll(msg.Body)
+	plain, html := messageText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), body)
+	if plain == "" {
+		plain = htmlTag.ReplaceAllString(html, " ")
+	}
+
+	m.date, err = msg.Header.Date()
+	if err != nil {
+		m.date = fallbackDate
+	}
+	m.to = msg.Header.Get("To")
+	m.text = msg.Header.Get("Subject") + "\n" + plain
+	return m, true
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// messageText decodes body of a message or its part into plain text and HTML,
+// text parts of multipart bodies are joined, attachments are skipped.
+func messageText(contentType, encoding string, body []byte) (plain, html string) {
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		if decoded, err := ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(body))); err == nil {
+			body = decoded
+		}
+	case "base64":
+		if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), "")); err == nil {
+			body = decoded
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			partBody, _ := ioutil.ReadAll(part)
+			partPlain, partHtml := messageText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), partBody)
+			plain += partPlain
+			html += partHtml
+		}
+	case mediaType == "text/html":
+		html = string(body) + "\n"
+	case strings.HasPrefix(mediaType, "text/"):
+		plain = string(body) + "\n"
+	}
+	return plain, html
+}
@@ -0,0 +1,225 @@
+package jobrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// test vectors of RFC 6238 for HMAC-SHA1, secret is "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1111111111: "14050471",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for unix, expected := range vectors {
+		if code, err := TOTP(secret, time.Unix(unix, 0), 8, 30*time.Second); err != nil || code != expected {
+			t.Errorf("expected code %s at %d, got %s, %v", expected, unix, code, err)
+		}
+	}
+
+	code, err := TOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0), 0, 0)
+	if err != nil || code != "287082" {
+		t.Errorf("expected default 6 digit code from spaced lowercase secret, got %s, %v", code, err)
+	}
+
+	_, err = TOTP("not base32!", time.Now(), 6, 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid totp secret: ") {
+		t.Errorf("expected invalid secret error, got %v", err)
+	}
+}
+
+func TestOTPResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	maildir := filepath.Join(dir, "maildir")
+	os.MkdirAll(filepath.Join(maildir, "new"), 0755)
+	os.MkdirAll(filepath.Join(maildir, "cur"), 0755)
+	writeMessage := func(name, to, date, body string) {
+		message := "To: " + to + "\r\nSubject: Your verification code\r\nDate: " + date + "\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" + body
+		ioutil.WriteFile(filepath.Join(maildir, name), []byte(message), 0644)
+	}
+	writeMessage("cur/1", "alice@test.example", "Mon, 02 Jan 2006 15:00:00 +0000", "Your code is 111111.")
+	writeMessage("new/2", "Alice <alice@test.example>", "Mon, 02 Jan 2006 15:04:05 +0000", "Your code is <b>222=\r\n222</b>, order 12345678.")
+	writeMessage("new/3", "bob@test.example", "Mon, 02 Jan 2006 15:10:00 +0000", "Your code is 333333.")
+
+	mbox := filepath.Join(dir, "mbox")
+	ioutil.WriteFile(mbox, []byte(strings.Join([]string{
+		"From sink@test.example Mon Jan  2 15:00:00 2006",
+		"To: alice@test.example",
+		"Subject: 3DS code 4444",
+		"",
+		">From the bank: ignore this.",
+		"",
+		"From sink@test.example Mon Jan  2 15:05:00 2006",
+		"To: alice@test.example",
+		"Subject: 3DS code",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"WW91ciBjb2RlOiA1NTU1",
+		"",
+	}, "\n")), 0644)
+
+	now, _ := time.Parse(time.RFC1123Z, "Mon, 02 Jan 2006 15:20:00 +0000")
+	resolve := func(source OTPSource) (string, error) {
+		code, err := source.Code(now, time.Time{})
+		return code, err
+	}
+
+	t.Run("maildir", func(t *testing.T) {
+		if code, err := resolve(OTPSource{Mailbox: maildir}); err != nil || code != "333333" {
+			t.Errorf("expected code of newest message, got %s, %v", code, err)
+		}
+		if code, err := resolve(OTPSource{Mailbox: maildir, Recipient: "ALICE@test.example"}); err != nil || code != "222222" {
+			t.Errorf("expected code of newest message to recipient, got %s, %v", code, err)
+		}
+		if code, err := resolve(OTPSource{Mailbox: maildir, Recipient: "alice", Pattern: `order (\d+)`}); err != nil || code != "12345678" {
+			t.Errorf("expected code matching custom pattern, got %s, %v", code, err)
+		}
+		_, err := resolve(OTPSource{Mailbox: maildir, MaxAge: time.Minute})
+		expectError(t, "no code found in "+maildir, err)
+	})
+
+	t.Run("mbox", func(t *testing.T) {
+		code, err := resolve(OTPSource{Mailbox: mbox, Pattern: `\b\d{4}\b`})
+		if err != nil || code != "5555" {
+			t.Errorf("expected code of the last message, got %s, %v", code, err)
+		}
+		code, err = resolve(OTPSource{Mailbox: mbox, Pattern: `From the (\w+)`})
+		if err != nil || code != "bank" {
+			t.Errorf("expected escaped From line to be unescaped, got %s, %v", code, err)
+		}
+	})
+
+	t.Run("wait for message", func(t *testing.T) {
+		var waited []time.Duration
+		timeSleep = func(d time.Duration) {
+			waited = append(waited, d)
+			writeMessage("new/4", "carol@test.example", "Mon, 02 Jan 2006 15:15:00 +0000", "Your code is 444444.")
+		}
+		defer func() { timeSleep = time.Sleep }()
+
+		code, err := resolve(OTPSource{Mailbox: maildir, Recipient: "carol", Wait: time.Minute})
+		if err != nil || code != "444444" || len(waited) != 1 {
+			t.Errorf("expected code of arrived message, got %s, %v after %v", code, err, waited)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		multipartDir := filepath.Join(dir, "multipart")
+		os.MkdirAll(filepath.Join(multipartDir, "new"), 0755)
+		ioutil.WriteFile(filepath.Join(multipartDir, "new", "1"), []byte(strings.Join([]string{
+			"To: dave@test.example",
+			"Subject: Sign in",
+			"Date: Mon, 02 Jan 2006 15:00:00 +0000",
+			"Content-Type: multipart/alternative; boundary=outer",
+			"",
+			"--outer",
+			"Content-Type: text/plain; charset=utf-8",
+			"Content-Transfer-Encoding: base64",
+			"",
+			"WW91ciBjb2RlIGlzIDY2NjY2Ni4=",
+			"--outer",
+			"Content-Type: text/html; charset=utf-8",
+			"",
+			`<p style="color: #123456">Your code is <b>666666</b>.</p>`,
+			"--outer--",
+			"",
+		}, "\r\n")), 0644)
+		ioutil.WriteFile(filepath.Join(multipartDir, "new", "2"), []byte(strings.Join([]string{
+			"To: erin@test.example",
+			"Subject: Sign in",
+			"Date: Mon, 02 Jan 2006 15:00:00 +0000",
+			"Content-Type: multipart/mixed; boundary=outer",
+			"",
+			"--outer",
+			"Content-Type: text/html; charset=utf-8",
+			"Content-Transfer-Encoding: quoted-printable",
+			"",
+			`<p style=3D"color: #123456">Your code is <b>777777</b>.</p>`,
+			"--outer",
+			"Content-Type: text/plain",
+			"Content-Disposition: attachment; filename=terms.txt",
+			"",
+			"Reference 999999",
+			"--outer--",
+			"",
+		}, "\r\n")), 0644)
+
+		if code, err := resolve(OTPSource{Mailbox: multipartDir, Recipient: "dave"}); err != nil || code != "666666" {
+			t.Errorf("expected code of plain text part, got %s, %v", code, err)
+		}
+		if code, err := resolve(OTPSource{Mailbox: multipartDir, Recipient: "erin"}); err != nil || code != "777777" {
+			t.Errorf("expected code of html part without markup and attachments, got %s, %v", code, err)
+		}
+	})
+
+	t.Run("old codes are not reused", func(t *testing.T) {
+		freshDir := filepath.Join(dir, "fresh")
+		os.MkdirAll(filepath.Join(freshDir, "new"), 0755)
+		deliver := func(name, date, code string) {
+			message := "To: frank@test.example\r\nSubject: Code\r\nDate: " + date + "\r\n\r\nYour code is " + code + "."
+			ioutil.WriteFile(filepath.Join(freshDir, "new", name), []byte(message), 0644)
+		}
+		deliver("1", "Mon, 02 Jan 2006 15:00:00 +0000", "111111")
+
+		var waited []time.Duration
+		timeSleep = func(d time.Duration) {
+			waited = append(waited, d)
+			deliver("2", "Mon, 02 Jan 2006 15:10:00 +0000", "222222")
+		}
+		defer func() { timeSleep = time.Sleep }()
+
+		resolver := OTPResolver(map[string]OTPSource{"emailCode": {Mailbox: freshDir, Wait: time.Minute}})
+		awaitingSince, _ := time.Parse(time.RFC1123Z, "Mon, 02 Jan 2006 15:09:00 +0000")
+		code, err := resolver(InputRequest{Key: "emailCode", AwaitingSince: awaitingSince})
+		if err != nil || code != "222222" || len(waited) != 1 {
+			t.Errorf("expected to wait for code sent after input was awaited, got %s, %v after %v", code, err, waited)
+		}
+
+		waited = nil
+		timeSleep = func(d time.Duration) {
+			waited = append(waited, d)
+			deliver("3", "Mon, 02 Jan 2006 15:11:00 +0000", "333333")
+		}
+		code, err = resolver(InputRequest{Key: "emailCode"})
+		if err != nil || code != "333333" || len(waited) != 1 {
+			t.Errorf("expected to wait for code newer than the used one, got %s, %v after %v", code, err, waited)
+		}
+	})
+
+	t.Run("resolver", func(t *testing.T) {
+		resolver := OTPResolver(map[string]OTPSource{
+			"otp":       {TOTPSecret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+			"emailCode": {Mailbox: filepath.Join(dir, "missing")},
+			"smsCode":   {},
+		})
+
+		before, _ := TOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Now(), 6, 0)
+		code, err := resolver(InputRequest{Key: "otp"})
+		after, _ := TOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Now(), 6, 0)
+		if err != nil || (code != before && code != after) {
+			t.Errorf("expected current totp code %s, got %v, %v", after, code, err)
+		}
+
+		if _, err = resolver(InputRequest{Key: "passengers"}); err != ErrUnresolved {
+			t.Errorf("expected other inputs to be unresolved, got %v", err)
+		}
+		_, err = resolver(InputRequest{Key: "smsCode"})
+		expectError(t, "one-time code for input smsCode: neither totp secret nor mailbox is configured", err)
+		if _, err = resolver(InputRequest{Key: "emailCode"}); err == nil || !strings.HasPrefix(err.Error(), "one-time code for input emailCode: ") {
+			t.Errorf("expected missing mailbox error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package jobrunner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Overrides alter data generated by jib before job is created, options are:
+// - MergePatch: JSON Merge Patch (RFC 7396), e.g. {"passengers": null} removes passengers
+// - JSONPatch: JSON Patch (RFC 6902) operations applied after merge patch,
+// e.g. {"op": "replace", "path": "/passengers/0/dateOfBirth", "value": "1900-01-01"}
+// First segment of a path is an input key.
+type Overrides struct {
+	MergePatch map[string]interface{} `json:"mergePatch,omitempty"`
+	JSONPatch  []PatchOperation       `json:"jsonPatch,omitempty"`
+}
+
+// PatchOperation is a single JSON Patch operation: add, remove, replace, move, copy or test.
+// From is used by move and copy, Value by add, replace and test.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Apply returns a copy of input data with overrides applied, nil Overrides return data as is.
+func (o *Overrides) Apply(data map[string]interface{}) (map[string]interface{}, error) {
+	if o == nil {
+		return data, nil
+	}
+
+	var patched interface{} = data
+	if o.MergePatch != nil {
+		patched = ApplyMergePatch(patched, o.MergePatch)
+	}
+
+	patched, err := ApplyJSONPatch(patched, o.JSONPatch)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("overrides must keep input data an object, got " + jsonType(patched))
+	}
+	return result, nil
+}
+
+// redact returns a copy of overrides with sensitive values masked,
+// values of patch operations are redacted according to their paths.
+func (o *Overrides) redact(r *Redactor) *Overrides {
+	if o == nil || r == nil {
+		return o
+	}
+
+	redacted := &Overrides{}
+	if o.MergePatch != nil {
+		redacted.MergePatch, _ = r.Redact(o.MergePatch).(map[string]interface{})
+	}
+	for _, op := range o.JSONPatch {
+		tokens, _ := pointerTokens(op.Path)
+		if op.Value != nil && len(tokens) > 0 {
+			// nest value at its path, so redaction patterns apply to it
+			var nested interface{} = op.Value
+			for i := len(tokens) - 1; i >= 0; i-- {
+				nested = map[string]interface{}{tokens[i]: nested}
+			}
+			nested = r.Redact(nested)
+			for _, token := range tokens {
+				m, ok := nested.(map[string]interface{})
+				if !ok {
+					break
+				}
+				nested = m[token]
+			}
+			op.Value = nested
+		}
+		redacted.JSONPatch = append(redacted.JSONPatch, op)
+	}
+	return redacted
+}
+
+// ApplyMergePatch applies JSON Merge Patch (RFC 7396) to target, target is not modified.
+func ApplyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, _ := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(t)+len(p))
+	for k, v := range t {
+		result[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = ApplyMergePatch(result[k], v)
+	}
+	return result
+}
+
+// ApplyJSONPatch applies JSON Patch (RFC 6902) operations to a copy of doc,
+// the whole patch fails when any of operations fails.
+func ApplyJSONPatch(doc interface{}, ops []PatchOperation) (interface{}, error) {
+	if len(ops) == 0 {
+		return doc, nil
+	}
+
+	result := normalizeJSON(doc)
+	for i, op := range ops {
+		var err error
+		if result, err = applyOperation(result, op); err != nil {
+			return nil, fmt.Errorf("json patch operation %d (%s %s) failed: %v", i, op.Op, op.Path, err)
+		}
+	}
+	return result, nil
+}
+
+func applyOperation(doc interface{}, op PatchOperation) (interface{}, error) {
+	path, ok := pointerTokens(op.Path)
+	if !ok {
+		return nil, errors.New("invalid path")
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		return patchAt(doc, path, op.Op, normalizeJSON(op.Value))
+	case "remove":
+		return patchAt(doc, path, op.Op, nil)
+	case "test":
+		value, found := resolvePointer(doc, op.Path)
+		if !found {
+			return nil, errors.New("path not found")
+		}
+		if !jsonEqual(value, op.Value) {
+			return nil, fmt.Errorf("expected %s, got %s", toJSON(op.Value), toJSON(value))
+		}
+		return doc, nil
+	case "move", "copy":
+		from, ok := pointerTokens(op.From)
+		if !ok {
+			return nil, errors.New("invalid from")
+		}
+		value, found := resolvePointer(doc, op.From)
+		if !found {
+			return nil, errors.New("from not found")
+		}
+		if op.Op == "copy" {
+			return patchAt(doc, path, "add", normalizeJSON(value))
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("can not move value into itself")
+		}
+		removed, err := patchAt(doc, from, "remove", nil)
+		if err != nil {
+			return nil, err
+		}
+		return patchAt(removed, path, "add", value)
+	}
+	return nil, errors.New("unknown operation")
+}
+
+// patchAt adds, replaces or removes value at path, containers on the way are modified in place.
+func patchAt(node interface{}, path []string, op string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		if op == "remove" {
+			return nil, errors.New("can not remove whole document")
+		}
+		return value, nil
+	}
+
+	token := path[0]
+	last := len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, exists := n[token]
+		switch {
+		case !last && !exists, last && op != "add" && !exists:
+			return nil, errors.New("path not found")
+		case !last:
+			updated, err := patchAt(child, path[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[token] = updated
+		case op == "remove":
+			delete(n, token)
+		default:
+			n[token] = value
+		}
+		return n, nil
+	case []interface{}:
+		if last && op == "add" && token == "-" {
+			return append(n, value), nil
+		}
+		i, err := strconv.Atoi(token)
+		limit := len(n)
+		if last && op == "add" {
+			limit++
+		}
+		if err != nil || i < 0 || i >= limit {
+			return nil, errors.New("path not found")
+		}
+		switch {
+		case !last:
+			updated, err := patchAt(n[i], path[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = updated
+		case op == "remove":
+			n = append(n[:i], n[i+1:]...)
+		case op == "add":
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+		default:
+			n[i] = value
+		}
+		return n, nil
+	}
+	return nil, errors.New("path not found")
+}
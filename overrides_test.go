@@ -0,0 +1,145 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	cases := []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`["a"]`, `{"a":"c"}`, `{"a":"c"}`},
+	}
+	for _, c := range cases {
+		var target, patch interface{}
+		json.Unmarshal([]byte(c.target), &target)
+		json.Unmarshal([]byte(c.patch), &patch)
+		if actual := toJSON(ApplyMergePatch(target, patch)); actual != c.expected {
+			t.Errorf("expected %s patched with %s to be %s, got %s", c.target, c.patch, c.expected, actual)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	patch := func(doc string, ops string) (string, error) {
+		var d interface{}
+		var o []PatchOperation
+		json.Unmarshal([]byte(doc), &d)
+		json.Unmarshal([]byte(ops), &o)
+		result, err := ApplyJSONPatch(d, o)
+		return toJSON(result), err
+	}
+
+	t.Run("operations", func(t *testing.T) {
+		doc := `{"passengers": [{"name": "A"}, {"name": "B"}], "card": {"expiry": "2030-01"}}`
+		result, err := patch(doc, `[
+			{"op": "test", "path": "/passengers/0/name", "value": "A"},
+			{"op": "add", "path": "/passengers/1/dateOfBirth", "value": "1900-01-01"},
+			{"op": "add", "path": "/passengers/-", "value": {"name": "C"}},
+			{"op": "remove", "path": "/passengers/0"},
+			{"op": "replace", "path": "/card/expiry", "value": "2000-01"},
+			{"op": "copy", "from": "/card", "path": "/backupCard"},
+			{"op": "move", "from": "/backupCard/expiry", "path": "/expiry"}
+		]`)
+		expected := `{"backupCard":{},"card":{"expiry":"2000-01"},"expiry":"2000-01","passengers":[{"dateOfBirth":"1900-01-01","name":"B"},{"name":"C"}]}`
+		if err != nil || result != expected {
+			t.Errorf("expected %s, got %s, %v", expected, result, err)
+		}
+	})
+
+	t.Run("original is not modified", func(t *testing.T) {
+		doc := map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}
+		ApplyJSONPatch(doc, []PatchOperation{{Op: "remove", Path: "/a/b"}})
+		if toJSON(doc) != `{"a":{"b":1}}` {
+			t.Errorf("expected document not to be modified, got %v", doc)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := patch(`{"a": 1}`, `[{"op": "test", "path": "/a", "value": 2}]`)
+		expectError(t, "json patch operation 0 (test /a) failed: expected 2, got 1", err)
+		_, err = patch(`{"a": 1}`, `[{"op": "replace", "path": "/b", "value": 2}]`)
+		expectError(t, "json patch operation 0 (replace /b) failed: path not found", err)
+		_, err = patch(`{"a": [1]}`, `[{"op": "add", "path": "/a/2", "value": 2}]`)
+		expectError(t, "json patch operation 0 (add /a/2) failed: path not found", err)
+		_, err = patch(`{"a": {}}`, `[{"op": "move", "from": "/a", "path": "/a/b"}]`)
+		expectError(t, "json patch operation 0 (move /a/b) failed: can not move value into itself", err)
+		_, err = patch(`{}`, `[{"op": "swap", "path": "/a"}]`)
+		expectError(t, "json patch operation 0 (swap /a) failed: unknown operation", err)
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	var created map[string]interface{}
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			body = `{"passengers": [{"firstName": "Bob", "dateOfBirth": "1990-01-01"}], "payment": {"cvv": "123"}, "options": {}}`
+		case "POST http://api/jobs":
+			json.NewDecoder(req.Body).Decode(&created)
+			body = `{"id": "job-id"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	overrides := &Overrides{
+		MergePatch: map[string]interface{}{"options": nil, "payment": map[string]interface{}{"expiry": "2000-01"}},
+		JSONPatch:  []PatchOperation{{Op: "replace", Path: "/passengers/0/dateOfBirth", Value: "1900-01-01"}},
+	}
+
+	t.Run("applied before job creation", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		if _, err := jr.RunJob(JobRun{ServiceId: "service-id", Overrides: overrides}); err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"passengers":[{"dateOfBirth":"1900-01-01","firstName":"Bob"}],"payment":{"cvv":"123","expiry":"2000-01"}}`
+		if actual := toJSON(created["input"]); actual != expected {
+			t.Errorf("expected job to be created with %s, got %s", expected, actual)
+		}
+		if actual := toJSON(jr.InputData); actual != expected {
+			t.Errorf("expected patched data to be stashed, got %s", actual)
+		}
+	})
+
+	t.Run("failed patch prevents job creation", func(t *testing.T) {
+		created = nil
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		_, err := jr.RunJob(JobRun{ServiceId: "service-id", Overrides: &Overrides{
+			JSONPatch: []PatchOperation{{Op: "remove", Path: "/missing"}},
+		}})
+		expectError(t, "json patch operation 0 (remove /missing) failed: path not found", err)
+		if created != nil {
+			t.Errorf("expected job not to be created")
+		}
+	})
+
+	t.Run("redacted for reports", func(t *testing.T) {
+		redacted := (&Overrides{
+			MergePatch: map[string]interface{}{"payment": map[string]interface{}{"cvv": "000"}},
+			JSONPatch:  []PatchOperation{{Op: "add", Path: "/passengers/0", Value: map[string]interface{}{"firstName": "Eve", "age": 1}}},
+		}).redact(NewRedactor())
+		expected := &Overrides{
+			MergePatch: map[string]interface{}{"payment": map[string]interface{}{"cvv": RedactedValue}},
+			JSONPatch:  []PatchOperation{{Op: "add", Path: "/passengers/0", Value: map[string]interface{}{"firstName": RedactedValue, "age": json.Number("1")}}},
+		}
+		if !reflect.DeepEqual(redacted, expected) {
+			t.Errorf("expected %s, got %s", toJSON(expected), toJSON(redacted))
+		}
+	})
+}
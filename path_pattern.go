@@ -0,0 +1,79 @@
+package jobrunner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Path patterns are dot-separated paths into json data, array items are addressed by index.
+// "*" matches any single segment and "**" matches any number of segments (including none),
+// e.g. "finalPrice.value", "passengers.*.dateOfBirth" or "**.createdAt".
+
+// matchPathPattern reports whether path matches pattern.
+func matchPathPattern(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPathPattern(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 || (pattern[0] != "*" && pattern[0] != path[0]) {
+		return false
+	}
+
+	return matchPathPattern(pattern[1:], path[1:])
+}
+
+// replacePaths returns a copy of data where values located at paths matching any of patterns
+// are replaced with result of fn, value is removed from its parent when fn returns false.
+func replacePaths(data interface{}, patterns []string, fn func(interface{}) (interface{}, bool)) interface{} {
+	if len(patterns) == 0 {
+		return data
+	}
+
+	compiled := make([][]string, len(patterns))
+	for i, p := range patterns {
+		compiled[i] = strings.Split(p, ".")
+	}
+
+	result, _ := replaceAt(normalizeJSON(data), nil, compiled, fn)
+	return result
+}
+
+func replaceAt(data interface{}, path []string, patterns [][]string, fn func(interface{}) (interface{}, bool)) (interface{}, bool) {
+	if len(path) > 0 {
+		for _, p := range patterns {
+			if matchPathPattern(p, path) {
+				return fn(data)
+			}
+		}
+	}
+
+	switch d := data.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			if value, keep := replaceAt(v, append(path[:len(path):len(path)], k), patterns, fn); keep {
+				result[k] = value
+			}
+		}
+		return result, true
+	case []interface{}:
+		result := make([]interface{}, 0, len(d))
+		for i, v := range d {
+			if value, keep := replaceAt(v, append(path[:len(path):len(path)], strconv.Itoa(i)), patterns, fn); keep {
+				result = append(result, value)
+			}
+		}
+		return result, true
+	}
+
+	return data, true
+}
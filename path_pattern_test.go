@@ -0,0 +1,55 @@
+package jobrunner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchPathPattern(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.*", "a.c", true},
+		{"a.*", "a.c.d", false},
+		{"**.email", "email", true},
+		{"**.email", "passengers.0.email", true},
+		{"passengers.**", "passengers.0.name", true},
+		{"**.card.pan", "payment.card.pan", true},
+		{"**.card.pan", "payment.card.cvv", false},
+	}
+	for _, c := range cases {
+		if matchPathPattern(strings.Split(c.pattern, "."), strings.Split(c.path, ".")) != c.match {
+			t.Errorf("expected %q matching %q to be %v", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestReplacePaths(t *testing.T) {
+	data := map[string]interface{}{
+		"passengers": []interface{}{
+			map[string]interface{}{"name": "A", "email": "a@example.com"},
+		},
+		"email": "b@example.com",
+	}
+
+	result := replacePaths(data, []string{"**.email"}, func(interface{}) (interface{}, bool) {
+		return "***", true
+	})
+	expected := map[string]interface{}{
+		"passengers": []interface{}{
+			map[string]interface{}{"name": "A", "email": "***"},
+		},
+		"email": "***",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	if data["email"] != "b@example.com" {
+		t.Error("expected original data to stay intact")
+	}
+}
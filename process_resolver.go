@@ -0,0 +1,93 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultProcessTimeout limits how long resolver process may run when ProcessResolver is given no timeout.
+const DefaultProcessTimeout = 30 * time.Second
+
+// Decisions resolver process may return instead of input data.
+const (
+	// ProcessSkip leaves input unresolved, so next resolver is asked.
+	ProcessSkip = "skip"
+	// ProcessFail stops resolving input with an error.
+	ProcessFail = "fail"
+)
+
+// ProcessResponse is written by resolver process to its stdout: either data of input, e.g. {"data": {"id": "f2"}},
+// or a decision, e.g. {"decision": "fail", "message": "no economy fares"}.
+type ProcessResponse struct {
+	Data     interface{} `json:"data,omitempty"`
+	Decision string      `json:"decision,omitempty"`
+	Message  string      `json:"message,omitempty"`
+}
+
+// ProcessResolver runs executable with args for each input it is asked to resolve, e.g. a Python or Node script.
+// InputRequest is written as json to stdin of the process: job id, awaited key, input definition, all outputs and stashed
+// input data. Process must write ProcessResponse to stdout and exit with zero status within timeout,
+// it is killed when timeout passes. Stderr of failed process is reported in error.
+func ProcessResolver(timeout time.Duration, name string, args ...string) InputResolver {
+	if timeout <= 0 {
+		timeout = DefaultProcessTimeout
+	}
+
+	return func(req InputRequest) (data interface{}, err error) {
+		stdin, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		fail := func(reason string) error {
+			return fmt.Errorf("resolver process %s %s for input %s", name, reason, req.Key)
+		}
+
+		if err = cmd.Run(); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, fail("timed out after " + timeout.String())
+			}
+			reason := "failed: " + err.Error()
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				reason += ": " + message
+			}
+			return nil, fail(reason)
+		}
+
+		var res ProcessResponse
+		if err = decodeJSON(stdout.Bytes(), &res); err != nil {
+			return nil, fail("returned invalid response: " + err.Error())
+		}
+
+		switch res.Decision {
+		case "":
+			if res.Data == nil {
+				return nil, fail("returned no data")
+			}
+			return res.Data, nil
+		case ProcessSkip:
+			return nil, ErrUnresolved
+		case ProcessFail:
+			if res.Message == "" {
+				res.Message = "no reason given"
+			}
+			return nil, errors.New("resolver process " + name + " refused input " + req.Key + ": " + res.Message)
+		}
+		return nil, fail("returned unknown decision " + res.Decision)
+	}
+}
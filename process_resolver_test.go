@@ -0,0 +1,118 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestResolverProcess is not a real test, it is run as resolver process by TestProcessResolver.
+func TestResolverProcess(t *testing.T) {
+	if os.Getenv("JOBRUNNER_RESOLVER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	var req InputRequest
+	decodeJSON(mustReadAll(os.Stdin), &req)
+	switch mode := os.Args[len(os.Args)-1]; mode {
+	case "echo":
+		fares, _ := req.Output("availableFares")
+		fmt.Printf(`{"data": {"key": %q, "job": %q, "fare": %s, "stashed": %s, "source": %q}}`,
+			req.Key, req.JobId, toJSON(fares.([]interface{})[1]), toJSON(req.InputData["passengers"]), req.Definition.SourceOutputKey)
+	case "skip":
+		fmt.Print(`{"decision": "skip"}`)
+	case "fail":
+		fmt.Print(`{"decision": "fail", "message": "no economy fares"}`)
+	case "unknown":
+		fmt.Print(`{"decision": "retry"}`)
+	case "empty":
+		fmt.Print(`{}`)
+	case "garbage":
+		fmt.Print(`not json`)
+	case "crash":
+		fmt.Fprint(os.Stderr, "traceback: boom\n")
+		os.Exit(3)
+	case "hang":
+		time.Sleep(time.Minute)
+	}
+}
+
+func mustReadAll(f *os.File) []byte {
+	b, _ := ioutil.ReadAll(f)
+	return b
+}
+
+func TestProcessResolver(t *testing.T) {
+	os.Setenv("JOBRUNNER_RESOLVER_PROCESS", "1")
+	defer os.Unsetenv("JOBRUNNER_RESOLVER_PROCESS")
+
+	var sent string
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "selectedFare"}`
+		case "GET http://api/jobs/job-id/outputs":
+			body = `{"data": [{"key": "availableFares", "data": [{"id": 1}, {"id": 12345678901234567890}]}]}`
+		case "GET https://protocol.automationcloud.net/schema.json":
+			body = `{"domains": {"A": {"inputs": {"selectedFare": {"sourceOutputKey": "availableFares"}}}}}`
+		case "POST http://api/jobs/job-id/inputs":
+			var input struct {
+				Data json.RawMessage `json:"data"`
+			}
+			json.NewDecoder(req.Body).Decode(&input)
+			sent = string(input.Data)
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	run := func(mode string, timeout time.Duration) error {
+		sent = ""
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "A")
+		jr.InputData = map[string]interface{}{"passengers": []interface{}{"Bob"}}
+		jr.Resolvers = []InputResolver{
+			ProcessResolver(timeout, os.Args[0], "-test.run=TestResolverProcess", "--", mode),
+		}
+		return jr.CreateInput()
+	}
+
+	t.Run("data", func(t *testing.T) {
+		err := run("echo", 0)
+		expected := `{"fare":{"id":12345678901234567890},"job":"job-id","key":"selectedFare","source":"availableFares","stashed":["Bob"]}`
+		if err != nil || sent != expected {
+			t.Errorf("expected %s to be sent, got %s, %v", expected, sent, err)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		err := run("skip", 0)
+		expectError(t, "unexpected awaitingInputKey selectedFare", err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		resolver := "resolver process " + os.Args[0]
+		expectError(t, resolver+" refused input selectedFare: no economy fares", run("fail", 0))
+		expectError(t, resolver+" returned unknown decision retry for input selectedFare", run("unknown", 0))
+		expectError(t, resolver+" returned no data for input selectedFare", run("empty", 0))
+		expectError(t, resolver+" returned invalid response: invalid character 'o' in literal null (expecting 'u') for input selectedFare", run("garbage", 0))
+		expectError(t, resolver+" failed: exit status 3: traceback: boom for input selectedFare", run("crash", 0))
+		expectError(t, resolver+" timed out after 200ms for input selectedFare", run("hang", 200*time.Millisecond))
+		if sent != "" {
+			t.Errorf("expected no input to be sent, got %s", sent)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package jobrunner
+
+import "strings"
+
+// RedactedValue replaces sensitive values unless Redactor.Mask is set.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactionPatterns cover payment cards, personal details and credentials found in jib data.
+var DefaultRedactionPatterns = []string{
+	"**.pan",
+	"**.cardNumber",
+	"**.cvv",
+	"**.email",
+	"**.phone",
+	"**.firstName",
+	"**.lastName",
+	"**.dateOfBirth",
+	"**.password",
+}
+
+// Redactor masks sensitive values in data which leaves job runner: timeline events, reports and snapshots.
+// Data sent to automation cloud api is never redacted.
+// Patterns are path patterns (e.g. "payment.card.pan", "**.email"), see matchPathPattern,
+// first segment of a path is an input or output key.
+type Redactor struct {
+	Patterns []string `json:"patterns"`
+	Mask     string   `json:"mask,omitempty"`
+}
+
+// NewRedactor creates Redactor with DefaultRedactionPatterns and additional patterns.
+func NewRedactor(patterns ...string) *Redactor {
+	return &Redactor{
+		Patterns: append(append([]string{}, DefaultRedactionPatterns...), patterns...),
+	}
+}
+
+// Redact returns a copy of data with values matching redaction patterns masked,
+// nil Redactor returns data as is.
+func (r *Redactor) Redact(data interface{}) interface{} {
+	if r == nil || data == nil {
+		return data
+	}
+
+	mask := r.mask()
+	return replacePaths(data, r.Patterns, func(interface{}) (interface{}, bool) {
+		return mask, true
+	})
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask == "" {
+		return RedactedValue
+	}
+	return r.Mask
+}
+
+// maskPath returns mask of value at path when the path or any of its parents matches redaction patterns,
+// first segment of path is an input or output key.
+func (r *Redactor) maskPath(path []string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	for _, p := range r.Patterns {
+		pattern := strings.Split(p, ".")
+		for i := 1; i <= len(path); i++ {
+			if matchPathPattern(pattern, path[:i]) {
+				return r.mask(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// RedactKey redacts data stored under given input or output key.
+func (r *Redactor) RedactKey(key string, data interface{}) interface{} {
+	if r == nil || data == nil {
+		return data
+	}
+
+	redacted, _ := r.Redact(map[string]interface{}{key: data}).(map[string]interface{})
+	return redacted[key]
+}
@@ -0,0 +1,105 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	data := map[string]interface{}{
+		"payment": map[string]interface{}{
+			"card": map[string]interface{}{"pan": "4111111111111111", "expirationDate": "2030-01"},
+		},
+		"passengers": []interface{}{
+			map[string]interface{}{"firstName": "Jane", "title": "mrs"},
+		},
+	}
+
+	t.Run("default patterns", func(t *testing.T) {
+		expected := map[string]interface{}{
+			"payment": map[string]interface{}{
+				"card": map[string]interface{}{"pan": RedactedValue, "expirationDate": "2030-01"},
+			},
+			"passengers": []interface{}{
+				map[string]interface{}{"firstName": RedactedValue, "title": "mrs"},
+			},
+		}
+		if result := NewRedactor().Redact(data); !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("key and custom mask", func(t *testing.T) {
+		r := &Redactor{Patterns: []string{"payment.card.expirationDate"}, Mask: "***"}
+		expected := map[string]interface{}{
+			"card": map[string]interface{}{"pan": "4111111111111111", "expirationDate": "***"},
+		}
+		if result := r.RedactKey("payment", data["payment"]); !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("nil redactor", func(t *testing.T) {
+		var r *Redactor
+		if result := r.Redact(data); !reflect.DeepEqual(result, data) {
+			t.Errorf("expected data as is, got %v", result)
+		}
+	})
+}
+
+func TestRedactedRunner(t *testing.T) {
+	requestsMade := make(map[string]string)
+	responses := map[string]string{
+		"GET http://api/jobs/job-id":                 `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "account"}`,
+		"POST http://api/jobs/job-id/inputs":         `{"key": "account"}`,
+		"GET http://api/jobs/job-id/outputs/profile": `{"data": {"email": "jane@example.com"}}`,
+	}
+	client := newTestClient(func(req *http.Request) *http.Response {
+		request := req.Method + " " + req.URL.String()
+		if req.Body != nil {
+			body, _ := ioutil.ReadAll(req.Body)
+			requestsMade[request] = string(body)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(responses[request])),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.Redactor = NewRedactor()
+	jr.InputData = map[string]interface{}{
+		"account": map[string]interface{}{"email": "jane@example.com"},
+	}
+	jr.ResumeJob("job-id", "A")
+
+	t.Run("sends real values and records redacted", func(t *testing.T) {
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(requestsMade["POST http://api/jobs/job-id/inputs"], "jane@example.com") {
+			t.Errorf("expected real value to be sent, got %v", requestsMade["POST http://api/jobs/job-id/inputs"])
+		}
+		expected := map[string]interface{}{"email": RedactedValue}
+		if !reflect.DeepEqual(jr.Events[0].Data, expected) {
+			t.Errorf("expected event data %v, got %v", expected, jr.Events[0].Data)
+		}
+	})
+
+	t.Run("redacts assertion diffs", func(t *testing.T) {
+		jr.Expectations = []Expectation{{OutputKey: "profile", Path: "email", Equals: "john@example.com"}}
+		results, err := jr.CheckExpectations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedDiff := `.: expected "john@example.com", got "[REDACTED]"`
+		if results[0].Passed || results[0].Diff != expectedDiff {
+			t.Errorf("expected diff %q, got %v", expectedDiff, results[0])
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package jobrunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// registry tracks unfinished jobs created or resumed through any JobRunner of the process.
+var registry = &jobRegistry{jobs: make(map[string]*JobRunner)}
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+// shutdownLockWait limits how long Shutdown waits for a busy runner, job is canceled without locking runner afterwards.
+// It is replaced in tests.
+var shutdownLockWait = time.Second
+
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*JobRunner
+	// services holds service id of each job, so it is known without locking a busy runner.
+	services map[string]string
+}
+
+func (r *jobRegistry) add(jobId string, jr *JobRunner, serviceId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[jobId] = jr
+	if r.services == nil {
+		r.services = make(map[string]string)
+	}
+	r.services[jobId] = serviceId
+}
+
+func (r *jobRegistry) remove(jobId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, jobId)
+	delete(r.services, jobId)
+}
+
+func (r *jobRegistry) serviceId(jobId string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.services[jobId]
+}
+
+func (r *jobRegistry) snapshot() map[string]*JobRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make(map[string]*JobRunner, len(r.jobs))
+	for id, jr := range r.jobs {
+		jobs[id] = jr
+	}
+	return jobs
+}
+
+// LiveJob describes a job which was unfinished at shutdown.
+type LiveJob struct {
+	JobId     string `json:"jobId"`
+	ServiceId string `json:"serviceId"`
+	State     string `json:"state"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ShutdownSummary lists what happened to unfinished jobs at shutdown.
+// Canceled jobs were canceled successfully, jobs in LeftBehind may still be running.
+type ShutdownSummary struct {
+	Canceled   []LiveJob `json:"canceled"`
+	Finished   []LiveJob `json:"finished"`
+	LeftBehind []LiveJob `json:"leftBehind"`
+}
+
+// String makes human-readable representation of a summary.
+func (s ShutdownSummary) String() string {
+	lines := []string{fmt.Sprintf(
+		"shutdown: %d jobs canceled, %d already finished, %d left behind",
+		len(s.Canceled), len(s.Finished), len(s.LeftBehind),
+	)}
+	for _, j := range s.LeftBehind {
+		lines = append(lines, fmt.Sprintf("  left behind: job %s of service %s in %s state: %s", j.JobId, j.ServiceId, j.State, j.Error))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LiveJobs returns ids of unfinished jobs known to any JobRunner of the process.
+func LiveJobs() []string {
+	jobs := registry.snapshot()
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Shutdown cancels all unfinished jobs created or resumed through any JobRunner of the process.
+// Jobs which could not be canceled before ctx is done are reported as left behind.
+// Job of a runner busy for longer than a second, e.g. waiting for input data, is canceled without waiting for the runner.
+func Shutdown(ctx context.Context) (summary ShutdownSummary) {
+	jobs := registry.snapshot()
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		jr := jobs[id]
+		live := LiveJob{JobId: id, ServiceId: registry.serviceId(id)}
+		if err := ctx.Err(); err != nil {
+			live.Error = err.Error()
+			summary.LeftBehind = append(summary.LeftBehind, live)
+			continue
+		}
+
+		canceled, state, err := jr.shutdownJob(ctx, id)
+		live.State = state
+		switch {
+		case err != nil:
+			live.Error = err.Error()
+			summary.LeftBehind = append(summary.LeftBehind, live)
+		case canceled:
+			summary.Canceled = append(summary.Canceled, live)
+		default:
+			summary.Finished = append(summary.Finished, live)
+		}
+	}
+	return
+}
+
+// shutdownJob cancels job unless it has already finished. Job of a runner which stays locked
+// for shutdownLockWait or which runner does not track anymore is canceled without touching runner state.
+func (jr *JobRunner) shutdownJob(ctx context.Context, jobId string) (canceled bool, state string, err error) {
+	lockCtx, cancel := context.WithTimeout(ctx, shutdownLockWait)
+	defer cancel()
+	if jr.lock(lockCtx) {
+		defer jr.mu.Unlock()
+		for _, job := range jr.Jobs {
+			if job.Id != jobId {
+				continue
+			}
+			canceled, err = jr.cancelForShutdown(ctx, job)
+			if canceled {
+				jr.record(Event{JobId: job.Id, Type: EventJobCanceled, Message: "process shutdown"})
+			}
+			jr.observe(job)
+			return canceled, job.State, err
+		}
+	}
+
+	job := &cl.Job{Id: jobId}
+	canceled, err = jr.cancelForShutdown(ctx, job)
+	if isFinished(job.State) {
+		registry.remove(jobId)
+	}
+	return canceled, job.State, err
+}
+
+// cancelForShutdown reloads job and cancels it unless it has already finished, requests are aborted when ctx is done.
+func (jr *JobRunner) cancelForShutdown(ctx context.Context, job *cl.Job) (canceled bool, err error) {
+	if err = jr.apiRequestContext(ctx, "GET", "/jobs/"+job.Id, nil, job); err != nil || isFinished(job.State) {
+		return false, err
+	}
+	if err = jr.apiRequestContext(ctx, "POST", "/jobs/"+job.Id+"/cancel", nil, nil); err != nil {
+		return false, err
+	}
+	return true, jr.apiRequestContext(ctx, "GET", "/jobs/"+job.Id, nil, job)
+}
+
+// lock waits for runner to be unlocked until ctx is done, false is returned when runner was not locked.
+func (jr *JobRunner) lock(ctx context.Context) bool {
+	locked := make(chan struct{})
+	go func() {
+		jr.mu.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return true
+	case <-ctx.Done():
+		// lock taken later is released right away
+		go func() {
+			<-locked
+			jr.mu.Unlock()
+		}()
+		return false
+	}
+}
+
+// CancelOnSignal installs a handler which calls Shutdown when process receives one of signals
+// (SIGINT and SIGTERM when none given), writes summary to w and exits with status 1.
+// Shutdown is given timeout to complete. Returned function uninstalls the handler.
+func CancelOnSignal(w io.Writer, timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, signals...)
+
+	go func() {
+		select {
+		case sig := <-c:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			fmt.Fprintln(w, "received", sig.String()+", canceling live jobs")
+			fmt.Fprintln(w, Shutdown(ctx).String())
+			exit(1)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
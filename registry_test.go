@@ -0,0 +1,226 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newRegistryTestRunner(t *testing.T) *JobRunner {
+	states := map[string]string{
+		"job-1": "processing",
+		"job-2": "awaitingInput",
+		"job-3": "processing",
+	}
+	client := newTestClient(func(req *http.Request) *http.Response {
+		status := 200
+		body := ""
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-1", "GET http://api/jobs/job-2", "GET http://api/jobs/job-3":
+			id := strings.TrimPrefix(req.URL.Path, "/jobs/")
+			body = `{"id": "` + id + `", "state": "` + states[id] + `"}`
+		case "POST http://api/jobs/job-1/cancel":
+			states["job-1"] = "fail"
+		case "POST http://api/jobs/job-3/cancel":
+			status = 500
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.JobRun.ServiceId = "service-id"
+	for _, id := range []string{"job-1", "job-2", "job-3"} {
+		if err := jr.ResumeJob(id, "A"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	states["job-2"] = "success"
+	return &jr
+}
+
+func withTestRegistry(t *testing.T, fn func()) {
+	previous := registry
+	registry = &jobRegistry{jobs: make(map[string]*JobRunner)}
+	defer func() { registry = previous }()
+	fn()
+}
+
+func TestShutdown(t *testing.T) {
+	withTestRegistry(t, func() {
+		newRegistryTestRunner(t)
+		if live := LiveJobs(); !reflect.DeepEqual(live, []string{"job-1", "job-2", "job-3"}) {
+			t.Fatalf("expected all jobs to be live, got %v", live)
+		}
+
+		summary := Shutdown(context.Background())
+		expected := ShutdownSummary{
+			Canceled:   []LiveJob{{JobId: "job-1", ServiceId: "service-id", State: "fail"}},
+			Finished:   []LiveJob{{JobId: "job-2", ServiceId: "service-id", State: "success"}},
+			LeftBehind: []LiveJob{{JobId: "job-3", ServiceId: "service-id", State: "processing", Error: "server error"}},
+		}
+		if !reflect.DeepEqual(summary, expected) {
+			t.Errorf("expected %v, got %v", expected, summary)
+		}
+
+		if live := LiveJobs(); !reflect.DeepEqual(live, []string{"job-3"}) {
+			t.Errorf("expected only job-3 to stay live, got %v", live)
+		}
+
+		expectedString := "shutdown: 1 jobs canceled, 1 already finished, 1 left behind\n" +
+			"  left behind: job job-3 of service service-id in processing state: server error"
+		if summary.String() != expectedString {
+			t.Errorf("unexpected summary %q", summary.String())
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		withTestRegistry(t, func() {
+			newRegistryTestRunner(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			summary := Shutdown(ctx)
+			if len(summary.LeftBehind) != 3 || summary.LeftBehind[0].Error != "context canceled" {
+				t.Errorf("expected all jobs to be left behind, got %v", summary)
+			}
+		})
+	})
+
+	t.Run("busy runner", func(t *testing.T) {
+		withTestRegistry(t, func() {
+			jr := newRegistryTestRunner(t)
+			jr.mu.Lock()
+			defer jr.mu.Unlock()
+			shutdownLockWait = 10 * time.Millisecond
+			defer func() { shutdownLockWait = time.Second }()
+
+			summary := Shutdown(context.Background())
+			if len(summary.Canceled) != 1 || summary.Canceled[0] != (LiveJob{JobId: "job-1", ServiceId: "service-id", State: "fail"}) {
+				t.Errorf("expected job of busy runner to be canceled, got %v", summary)
+			}
+			if live := LiveJobs(); !reflect.DeepEqual(live, []string{"job-3"}) {
+				t.Errorf("expected only job-3 to stay live, got %v", live)
+			}
+		})
+	})
+
+	t.Run("reused runner", func(t *testing.T) {
+		withTestRegistry(t, func() {
+			states := make(map[string]string)
+			client := newTestClient(func(req *http.Request) *http.Response {
+				body := `{}`
+				id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/jobs/"), "/cancel")
+				switch request := req.Method + " " + req.URL.String(); request {
+				case "POST http://jib":
+				case "POST http://api/jobs":
+					id = "job-1"
+					if len(states) > 0 {
+						id = "job-2"
+					}
+					states[id] = "processing"
+					body = `{"id": "` + id + `", "state": "processing"}`
+				case "GET http://api/jobs/job-1", "GET http://api/jobs/job-2":
+					body = `{"id": "` + id + `", "state": "` + states[id] + `"}`
+				case "POST http://api/jobs/job-1/cancel", "POST http://api/jobs/job-2/cancel":
+					states[id] = "canceled"
+				default:
+					panic("undeclared request: " + request)
+				}
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+					Header:     make(http.Header),
+				}
+			})
+			jr := NewRunner(client, "apikey", "http://api", "http://jib")
+			for i := 0; i < 2; i++ {
+				if _, err := jr.RunJob(JobRun{ServiceId: "service-id"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// job dropped from runner is still known to registry
+			jr.Jobs = jr.Jobs[1:]
+
+			summary := Shutdown(context.Background())
+			expected := ShutdownSummary{Canceled: []LiveJob{
+				{JobId: "job-1", ServiceId: "service-id", State: "canceled"},
+				{JobId: "job-2", ServiceId: "service-id", State: "canceled"},
+			}}
+			if !reflect.DeepEqual(summary, expected) {
+				t.Errorf("expected jobs of both runs to be canceled, got %v", summary)
+			}
+		})
+	})
+
+	t.Run("requests are aborted", func(t *testing.T) {
+		withTestRegistry(t, func() {
+			hang := false
+			client := newTestClient(func(req *http.Request) *http.Response {
+				status := 200
+				if hang {
+					<-req.Context().Done()
+					status = 504
+				}
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id": "job-1", "state": "processing"}`)),
+					Header:     make(http.Header),
+				}
+			})
+			jr := NewRunner(client, "apikey", "http://api", "http://jib")
+			if err := jr.ResumeJob("job-1", "A"); err != nil {
+				t.Fatal(err)
+			}
+
+			hang = true
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			summary := Shutdown(ctx)
+			if len(summary.LeftBehind) != 1 || summary.LeftBehind[0].JobId != "job-1" {
+				t.Errorf("expected hanging job to be left behind, got %v", summary)
+			}
+		})
+	})
+}
+
+func TestCancelOnSignal(t *testing.T) {
+	withTestRegistry(t, func() {
+		newRegistryTestRunner(t)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		exitCode := 0
+		previous := exit
+		exit = func(code int) {
+			exitCode = code
+			wg.Done()
+		}
+		defer func() { exit = previous }()
+
+		var out bytes.Buffer
+		stop := CancelOnSignal(&out, time.Second, syscall.SIGUSR1)
+		defer stop()
+
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		wg.Wait()
+
+		if exitCode != 1 {
+			t.Errorf("expected exit code 1, got %d", exitCode)
+		}
+		if !strings.Contains(out.String(), "shutdown: 1 jobs canceled, 1 already finished, 1 left behind") {
+			t.Errorf("unexpected output %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reporter writes results of a batch of job runs in some format.
+type Reporter func(w io.Writer, results []RunResult) error
+
+// Reporters is a registry of reporters available by name, e.g. to be selected with -reporter flag of jobrunner-report.
+var Reporters = map[string]Reporter{
+	"html":  WriteHTMLReport,
+	"json":  WriteJSONReport,
+	"junit": WriteJUnitReport,
+}
+
+// ReporterByName looks up a reporter in Reporters registry.
+func ReporterByName(name string) (Reporter, error) {
+	reporter, ok := Reporters[name]
+	if !ok {
+		names := make([]string, 0, len(Reporters))
+		for n := range Reporters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown reporter %q, available reporters: %s", name, strings.Join(names, ", "))
+	}
+	return reporter, nil
+}
+
+// Summary is an aggregate of a batch of job runs.
+type Summary struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+// Summarize counts passed and failed runs.
+func Summarize(results []RunResult) (s Summary) {
+	for _, r := range results {
+		s.Total++
+		if r.Passed() {
+			s.Passed++
+		} else {
+			s.Failed++
+		}
+	}
+	return
+}
+
+// WriteJSONReport writes machine-readable report with summary and all run results.
+func WriteJSONReport(w io.Writer, results []RunResult) error {
+	type jsonResult struct {
+		RunResult
+		Name   string `json:"name"`
+		Passed bool   `json:"passed"`
+	}
+	report := struct {
+		Summary Summary      `json:"summary"`
+		Results []jsonResult `json:"results"`
+	}{
+		Summary: Summarize(results),
+		Results: make([]jsonResult, 0, len(results)),
+	}
+	for _, r := range results {
+		report.Results = append(report.Results, jsonResult{r, r.Name(), r.Passed()})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// ReadJSONReport reads run results back from a report written by WriteJSONReport,
+// so they can be written by another reporter.
+func ReadJSONReport(r io.Reader) ([]RunResult, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Results []RunResult `json:"results"`
+	}
+	if err := decodeJSON(b, &report); err != nil {
+		return nil, fmt.Errorf("invalid json report: %v", err)
+	}
+	return report.Results, nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes JUnit XML report with a test case per job run.
+func WriteJUnitReport(w io.Writer, results []RunResult) error {
+	summary := Summarize(results)
+	suite := junitTestSuite{
+		Name:     "job-runner",
+		Tests:    summary.Total,
+		Failures: summary.Failed,
+	}
+
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration()
+		if suite.Timestamp == "" && !r.StartedAt.IsZero() {
+			suite.Timestamp = r.StartedAt.UTC().Format("2006-01-02T15:04:05")
+		}
+
+		tc := junitTestCase{
+			ClassName: r.ServiceId,
+			Name:      r.Name(),
+			Time:      seconds(r.Duration()),
+			SystemOut: formatTimeline(r.Events),
+		}
+		if !r.Passed() {
+			tc.Failure = junitFailureFor(r)
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = seconds(total)
+
+	report := junitTestSuites{
+		Tests:    summary.Total,
+		Failures: summary.Failed,
+		Time:     seconds(total),
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitFailureFor(r RunResult) *junitFailure {
+	f := &junitFailure{Type: r.ErrorCode}
+	if f.Type == "" {
+		f.Type = "failure"
+	}
+
+	var details []string
+	switch {
+	case r.ErrorCode != "":
+		f.Message = "job failed with " + r.ErrorCode
+	case r.DeclineExpected && len(r.DeclinedInputs) == 0:
+		f.Message = "no consent declined although policy declines every consent"
+	case r.DeclineExpected && r.State == "canceled":
+		f.Message = "job expectations not met"
+	case r.State != "success":
+		f.Message = "job is in " + r.State + " state"
+	default:
+		f.Message = "job expectations not met"
+	}
+
+	if r.ErrorCode != "" {
+		details = append(details, "error: "+r.ErrorCode+" ("+r.ErrorCategory+")")
+	}
+	if len(r.UnansweredInputKeys) > 0 {
+		details = append(details, "unanswered inputs: "+strings.Join(r.UnansweredInputKeys, ", "))
+	}
+	for _, d := range r.DeclinedInputs {
+		details = append(details, "declined consent "+d)
+	}
+	for _, f := range r.Faults {
+		if f.Passed {
+			continue
+		}
+		expected, got := f.ExpectErrorCode, f.ErrorCode
+		if expected == "" {
+			expected = "any"
+		}
+		if got == "" {
+			got = "none"
+		}
+		details = append(details, "fault "+string(f.Type)+" of input "+f.Key+" expected error "+expected+", got "+got)
+	}
+	for _, a := range r.Assertions {
+		if a.Passed {
+			continue
+		}
+		details = append(details, "assertion "+a.Check+" failed for "+joinPath(a.OutputKey, a.Path)+":\n"+a.Diff)
+	}
+	f.Details = strings.Join(details, "\n")
+	return f
+}
+
+func formatTimeline(events []Event) string {
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		line := e.Time.UTC().Format(time.RFC3339) + " " + e.Type
+		if e.Key != "" {
+			line += " " + e.Key
+		}
+		if e.Message != "" {
+			line += ": " + e.Message
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
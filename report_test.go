@@ -0,0 +1,122 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var reportResults = []RunResult{
+	{
+		ServiceId:  "service-id",
+		DomainId:   "Flight",
+		Label:      "one-way",
+		JobId:      "job-1",
+		State:      "success",
+		StartedAt:  time.Date(2019, 3, 25, 15, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2019, 3, 25, 15, 0, 30, 0, time.UTC),
+		Events: []Event{
+			{Time: time.Date(2019, 3, 25, 15, 0, 0, 0, time.UTC), JobId: "job-1", Type: EventJobCreated},
+		},
+	},
+	{
+		ServiceId:           "service-id",
+		DomainId:            "Flight",
+		JobId:               "job-2",
+		State:               "fail",
+		ErrorCode:           "SeatsUnavailable",
+		ErrorCategory:       "website",
+		UnansweredInputKeys: []string{"selectedSeats"},
+		Assertions: []AssertionResult{
+			{OutputKey: "finalPrice", Path: "value", Check: "range", Diff: "expected <= 100, got 120"},
+		},
+	},
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJUnitReport(&buf, reportResults); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="2" failures="1" time="30.000">
+  <testsuite name="job-runner" tests="2" failures="1" time="30.000" timestamp="2019-03-25T15:00:00">
+    <testcase classname="service-id" name="service-id/Flight/one-way" time="30.000">
+      <system-out>2019-03-25T15:00:00Z jobCreated</system-out>
+    </testcase>
+    <testcase classname="service-id" name="service-id/Flight" time="0.000">
+      <failure message="job failed with SeatsUnavailable" type="SeatsUnavailable">error: SeatsUnavailable (website)&#xA;unanswered inputs: selectedSeats&#xA;assertion range failed for finalPrice.value:&#xA;expected &lt;= 100, got 120</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSONReport(&buf, reportResults); err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		Summary Summary `json:"summary"`
+		Results []struct {
+			Name                string   `json:"name"`
+			Passed              bool     `json:"passed"`
+			UnansweredInputKeys []string `json:"unansweredInputKeys"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Summary != (Summary{Total: 2, Passed: 1, Failed: 1}) {
+		t.Errorf("unexpected summary %v", report.Summary)
+	}
+	if report.Results[0].Name != "service-id/Flight/one-way" || !report.Results[0].Passed {
+		t.Errorf("unexpected first result %v", report.Results[0])
+	}
+	if report.Results[1].Passed || report.Results[1].UnansweredInputKeys[0] != "selectedSeats" {
+		t.Errorf("unexpected second result %v", report.Results[1])
+	}
+}
+
+func TestReadJSONReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSONReport(&buf, reportResults); err != nil {
+		t.Fatal(err)
+	}
+	results, err := ReadJSONReport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected, got bytes.Buffer
+	WriteJUnitReport(&expected, reportResults)
+	WriteJUnitReport(&got, results)
+	if got.String() != expected.String() {
+		t.Errorf("expected results read back to be reported the same, got:\n%s", got.String())
+	}
+
+	_, err = ReadJSONReport(strings.NewReader("<testsuites/>"))
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid json report: ") {
+		t.Errorf("expected invalid report error, got %v", err)
+	}
+}
+
+func TestReporterByName(t *testing.T) {
+	if _, err := ReporterByName("junit"); err != nil {
+		t.Error(err)
+	}
+
+	_, err := ReporterByName("yaml")
+	if err == nil || !strings.HasPrefix(err.Error(), `unknown reporter "yaml", available reporters: html, json, junit`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
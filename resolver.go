@@ -0,0 +1,138 @@
+package jobrunner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+// ErrUnresolved is returned by InputResolver which can not provide data for requested input,
+// next resolver is tried then.
+var ErrUnresolved = errors.New("input not resolved")
+
+// InputRequest describes input job awaits, it is passed to InputResolver.
+// AwaitingSince is when runner noticed job awaiting the input.
+type InputRequest struct {
+	JobId         string                 `json:"jobId"`
+	DomainId      string                 `json:"domainId"`
+	Key           string                 `json:"key"`
+	Stage         string                 `json:"stage,omitempty"`
+	Definition    *cl.InputDef           `json:"definition,omitempty"`
+	Outputs       []JobOutput            `json:"outputs"`
+	InputData     map[string]interface{} `json:"inputData,omitempty"`
+	AwaitingSince time.Time              `json:"awaitingSince"`
+}
+
+// Output returns data of output with given key.
+func (r InputRequest) Output(key string) (data interface{}, ok bool) {
+	for _, o := range r.Outputs {
+		if o.Key == key {
+			return o.Data, true
+		}
+	}
+	return nil, false
+}
+
+// InputResolver provides data for input which runner could not take from stashed input data
+// or derive from job outputs.
+type InputResolver func(req InputRequest) (data interface{}, err error)
+
+// resolveWithResolvers asks jr.Resolvers in order, first resolver which does not return ErrUnresolved wins.
+func (jr *JobRunner) resolveWithResolvers() (data interface{}, err error) {
+	if len(jr.Resolvers) == 0 {
+		return nil, ErrUnresolved
+	}
+
+	req, err := jr.inputRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resolve := range jr.Resolvers {
+		data, err = resolve(req)
+		if err != ErrUnresolved {
+			return data, err
+		}
+	}
+	return nil, ErrUnresolved
+}
+
+func (jr *JobRunner) inputRequest() (req InputRequest, err error) {
+	req = InputRequest{
+		JobId:     jr.Job.Id,
+		DomainId:  jr.DomainId,
+		Key:       jr.Job.AwaitingInputKey,
+		Stage:     jr.Job.AwaitingInputStage,
+		InputData: jr.stash(),
+	}
+	req.AwaitingSince = jr.observe(jr.Job).awaitingSince
+
+	if prot, err := jr.apiClient.GetProtocol(); err == nil {
+		if def, found := prot.Domains[jr.DomainId].Inputs[req.Key]; found {
+			req.Definition = &def
+		}
+	}
+
+	req.Outputs, err = jr.fetchOutputs()
+	return
+}
+
+// TerminalResolver asks operator to provide input data: it writes awaited input key, its definition
+// and job outputs to out and reads a line from in. Line is either json data, or number of an option
+// when definition refers to an output containing a list, empty line leaves input unresolved.
+func TerminalResolver(in io.Reader, out io.Writer) InputResolver {
+	reader := bufio.NewReader(in)
+	return func(req InputRequest) (data interface{}, err error) {
+		fmt.Fprintf(out, "job %s awaits input %q (domain %s)\n", req.JobId, req.Key, req.DomainId)
+		if req.Definition != nil {
+			fmt.Fprintf(out, "definition: %s\n", toJSON(req.Definition))
+		}
+		for _, o := range req.Outputs {
+			fmt.Fprintf(out, "output %s: %s\n", o.Key, toJSON(o.Data))
+		}
+
+		var options []interface{}
+		if req.Definition != nil {
+			source, _ := req.Output(req.Definition.SourceOutputKey)
+			options, _ = source.([]interface{})
+		}
+		for i, option := range options {
+			fmt.Fprintf(out, "  %d) %s\n", i+1, toJSON(option))
+		}
+
+		for {
+			fmt.Fprint(out, "enter input data as json")
+			if len(options) > 0 {
+				fmt.Fprint(out, " or option number")
+			}
+			fmt.Fprint(out, ", empty line to skip: ")
+
+			line, err := reader.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if line == "" {
+				return nil, ErrUnresolved
+			}
+
+			if n, convErr := strconv.Atoi(line); convErr == nil && len(options) > 0 {
+				if n >= 1 && n <= len(options) {
+					return options[n-1], nil
+				}
+				fmt.Fprintf(out, "option %d does not exist\n", n)
+			} else if jsonErr := decodeJSON([]byte(line), &data); jsonErr == nil {
+				return data, nil
+			} else {
+				fmt.Fprintf(out, "invalid json: %v\n", jsonErr)
+			}
+
+			if err != nil {
+				return nil, ErrUnresolved
+			}
+		}
+	}
+}
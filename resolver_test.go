@@ -0,0 +1,142 @@
+package jobrunner
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	cl "github.com/automationcloud/client-go"
+)
+
+func TestResolvers(t *testing.T) {
+	var sent string
+	responses := map[string]string{
+		"GET http://api/jobs/job-id":         `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "selectedFare"}`,
+		"GET http://api/jobs/job-id/outputs": `{"data": [{"key": "availableFares", "data": ["economy", "business"]}]}`,
+		"POST http://api/jobs/job-id/inputs": `{}`,
+		"GET https://protocol.automationcloud.net/schema.json": `{"domains": {"A": {"inputs": {
+			"selectedFare": {"sourceOutputKey": "availableFares"}
+		}}}}`,
+	}
+	client := newTestClient(func(req *http.Request) *http.Response {
+		request := req.Method + " " + req.URL.String()
+		response, ok := responses[request]
+		if !ok {
+			panic("undeclared request: " + request)
+		}
+		if req.Method == "POST" {
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = string(b)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(response)),
+			Header:     make(http.Header),
+		}
+	})
+
+	t.Run("first resolver providing data wins", func(t *testing.T) {
+		var requests []InputRequest
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "A")
+		jr.Resolvers = []InputResolver{
+			func(req InputRequest) (interface{}, error) {
+				requests = append(requests, req)
+				return nil, ErrUnresolved
+			},
+			func(req InputRequest) (interface{}, error) {
+				data, _ := req.Output("availableFares")
+				return data.([]interface{})[1], nil
+			},
+		}
+
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		if sent != `{"key":"selectedFare","data":"business"}` {
+			t.Errorf("unexpected input %v", sent)
+		}
+
+		expected := InputRequest{
+			JobId:      "job-id",
+			DomainId:   "A",
+			Key:        "selectedFare",
+			Definition: &cl.InputDef{SourceOutputKey: "availableFares"},
+			Outputs:    []JobOutput{{Key: "availableFares", Data: []interface{}{"economy", "business"}}},
+		}
+		if len(requests) == 1 && !requests[0].AwaitingSince.IsZero() {
+			expected.AwaitingSince = requests[0].AwaitingSince
+		}
+		if len(requests) != 1 || !reflect.DeepEqual(requests[0], expected) {
+			t.Errorf("expected request %v, got %v", expected, requests)
+		}
+	})
+
+	t.Run("no resolver provides data", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "A")
+		jr.Resolvers = []InputResolver{func(InputRequest) (interface{}, error) {
+			return nil, ErrUnresolved
+		}}
+		expectError(t, "unexpected awaitingInputKey selectedFare", jr.CreateInput())
+	})
+
+	t.Run("resolver fails", func(t *testing.T) {
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.ResumeJob("job-id", "A")
+		jr.Resolvers = []InputResolver{func(InputRequest) (interface{}, error) {
+			return nil, errors.New("resolver failed")
+		}}
+		expectError(t, "resolver failed", jr.CreateInput())
+	})
+}
+
+func TestTerminalResolver(t *testing.T) {
+	req := InputRequest{
+		JobId:      "job-id",
+		DomainId:   "A",
+		Key:        "selectedFare",
+		Definition: &cl.InputDef{SourceOutputKey: "availableFares", InputMethod: "SelectOne"},
+		Outputs:    []JobOutput{{Key: "availableFares", Data: []interface{}{"economy", "business"}}},
+	}
+
+	t.Run("pick an option", func(t *testing.T) {
+		var out bytes.Buffer
+		data, err := TerminalResolver(strings.NewReader("3\n2\n"), &out)(req)
+		if err != nil || data != "business" {
+			t.Errorf("expected second option, got %v, %v", data, err)
+		}
+		expectedOutput := `job job-id awaits input "selectedFare" (domain A)
+definition: {"sourceOutputKey":"availableFares","inputMethod":"SelectOne"}
+output availableFares: ["economy","business"]
+  1) "economy"
+  2) "business"
+enter input data as json or option number, empty line to skip: option 3 does not exist
+enter input data as json or option number, empty line to skip: `
+		if out.String() != expectedOutput {
+			t.Errorf("unexpected output:\n%s", out.String())
+		}
+	})
+
+	t.Run("type json", func(t *testing.T) {
+		var out bytes.Buffer
+		data, err := TerminalResolver(strings.NewReader("{oops\n{\"cabin\": \"first\"}"), &out)(InputRequest{Key: "k"})
+		if err != nil || !reflect.DeepEqual(data, map[string]interface{}{"cabin": "first"}) {
+			t.Errorf("unexpected data %v, %v", data, err)
+		}
+		if !strings.Contains(out.String(), "invalid json: invalid character 'o'") {
+			t.Errorf("expected invalid json to be reported, got %s", out.String())
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		_, err := TerminalResolver(strings.NewReader("\n"), ioutil.Discard)(req)
+		if err != ErrUnresolved {
+			t.Errorf("expected ErrUnresolved, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package jobrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Types of timeline events.
+const (
+	EventJobCreated      = "jobCreated"
+	EventInputSent       = "inputSent"
+	EventInputFailed     = "inputFailed"
+	EventInputUnresolved = "inputUnresolved"
+)
+
+// Event is a record in a job timeline.
+type Event struct {
+	Time    time.Time   `json:"time"`
+	JobId   string      `json:"jobId"`
+	Type    string      `json:"type"`
+	Key     string      `json:"key,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// record appends event related to current job to a timeline, event data is redacted.
+func (jr *JobRunner) record(e Event) {
+	e.Time = timeNow()
+	if e.Key != "" {
+		e.Data = jr.Redactor.RedactKey(e.Key, e.Data)
+	} else {
+		e.Data = jr.Redactor.Redact(e.Data)
+	}
+	if e.JobId == "" && jr.Job != nil {
+		e.JobId = jr.Job.Id
+	}
+	jr.Events = append(jr.Events, e)
+}
+
+// RunResult is an outcome of a job run, it is collected by CollectResult and consumed by reporters.
+type RunResult struct {
+	ServiceId           string            `json:"serviceId"`
+	DomainId            string            `json:"domainId"`
+	Label               string            `json:"label,omitempty"`
+	Overrides           *Overrides        `json:"overrides,omitempty"`
+	JobId               string            `json:"jobId"`
+	State               string            `json:"state"`
+	ErrorCode           string            `json:"errorCode,omitempty"`
+	ErrorCategory       string            `json:"errorCategory,omitempty"`
+	UnansweredInputKeys []string          `json:"unansweredInputKeys,omitempty"`
+	DeclinedInputs      []string          `json:"declinedInputs,omitempty"`
+	DeclineExpected     bool              `json:"declineExpected,omitempty"`
+	Faults              []FaultResult     `json:"faults,omitempty"`
+	Assertions          []AssertionResult `json:"assertions,omitempty"`
+	Outputs             []JobOutput       `json:"outputs,omitempty"`
+	Events              []Event           `json:"events"`
+	StartedAt           time.Time         `json:"startedAt"`
+	FinishedAt          time.Time         `json:"finishedAt"`
+}
+
+// Name identifies job run in reports: service, domain and label separated by slash.
+func (r RunResult) Name() string {
+	parts := []string{r.ServiceId}
+	if r.DomainId != "" {
+		parts = append(parts, r.DomainId)
+	}
+	if r.Label != "" {
+		parts = append(parts, r.Label)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Passed reports whether job succeeded, answered all inputs and met all expectations,
+// job with injected faults passes when every fault had expected outcome and expectations are met.
+// Job run with ConsentPolicy.Decline passes when consent was declined, job got canceled and expectations are met.
+func (r RunResult) Passed() bool {
+	if r.DeclineExpected {
+		return len(r.DeclinedInputs) > 0 && r.State == "canceled" && r.ErrorCode == "" && AllPassed(r.Assertions)
+	}
+	if len(r.Faults) > 0 {
+		for _, f := range r.Faults {
+			if !f.Passed {
+				return false
+			}
+		}
+		return AllPassed(r.Assertions)
+	}
+	return r.State == "success" && r.ErrorCode == "" && len(r.UnansweredInputKeys) == 0 && AllPassed(r.Assertions)
+}
+
+// Duration is a time job took from creation to last update.
+func (r RunResult) Duration() time.Duration {
+	if r.FinishedAt.Before(r.StartedAt) {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// CollectResult refreshes current job and gathers its outcome: state, error, outputs, expectation checks and timeline.
+func (jr *JobRunner) CollectResult() (result RunResult, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if jr.Job == nil {
+		return result, errors.New("job runner is not ready to collect result: no job created or resumed")
+	}
+
+	var raw json.RawMessage
+	if err = jr.apiRequest("GET", "/jobs/"+jr.Job.Id, nil, &raw); err != nil {
+		return
+	}
+
+	var job struct {
+		State string `json:"state"`
+		Error *struct {
+			Code     string `json:"code"`
+			Category string `json:"category"`
+		} `json:"error"`
+	}
+	if err = json.Unmarshal(raw, &job); err != nil {
+		return
+	}
+	if err = json.Unmarshal(raw, jr.Job); err != nil {
+		return
+	}
+
+	result = RunResult{
+		ServiceId:  jr.JobRun.ServiceId,
+		DomainId:   jr.DomainId,
+		Label:      jr.JobRun.Label,
+		Overrides:  jr.JobRun.Overrides.redact(jr.Redactor),
+		JobId:      jr.Job.Id,
+		State:      job.State,
+		StartedAt:  jr.Job.CreatedAt.Time,
+		FinishedAt: jr.Job.UpdatedAt.Time,
+	}
+	if job.Error != nil {
+		result.ErrorCode = job.Error.Code
+		result.ErrorCategory = job.Error.Category
+	}
+
+	for _, e := range jr.Events {
+		if e.JobId == jr.Job.Id {
+			result.Events = append(result.Events, e)
+		}
+	}
+	result.UnansweredInputKeys = unansweredInputKeys(result.Events)
+	result.DeclinedInputs = declinedInputs(result.Events)
+	result.DeclineExpected = jr.JobRun.Consent != nil && jr.JobRun.Consent.Decline
+	result.Faults = jr.faultResults(result.Events, job.State, result.ErrorCode)
+	if job.State == "awaitingInput" && !containsString(result.UnansweredInputKeys, jr.Job.AwaitingInputKey) {
+		result.UnansweredInputKeys = append(result.UnansweredInputKeys, jr.Job.AwaitingInputKey)
+	}
+
+	if result.Outputs, err = jr.fetchOutputs(); err != nil {
+		return
+	}
+	for i, o := range result.Outputs {
+		result.Outputs[i].Data = jr.Redactor.RedactKey(o.Key, o.Data)
+	}
+
+	result.Assertions, err = jr.checkExpectations()
+	return
+}
+
+// unansweredInputKeys lists keys which could not be resolved and were not sent afterwards.
+func unansweredInputKeys(events []Event) (keys []string) {
+	for i, e := range events {
+		if e.Type != EventInputUnresolved || containsString(keys, e.Key) {
+			continue
+		}
+		answered := false
+		for _, later := range events[i+1:] {
+			if later.Type == EventInputSent && later.Key == e.Key {
+				answered = true
+				break
+			}
+		}
+		if !answered {
+			keys = append(keys, e.Key)
+		}
+	}
+	return
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCollectResult(t *testing.T) {
+	responses := map[string]string{
+		"GET http://api/jobs/job-id": `{
+			"id": "job-id",
+			"state": "awaitingInput",
+			"awaitingInputKey": "selectedSeats",
+			"createdAt": 1553527953000,
+			"updatedAt": 1553527983000,
+			"error": null
+		}`,
+		"GET http://api/jobs/job-id/outputs":                   `{"data": [{"key": "availableSeats", "data": []}]}`,
+		"GET https://protocol.automationcloud.net/schema.json": `{"domains": {"A": {"inputs": {}}}}`,
+	}
+	client := newTestClient(func(req *http.Request) *http.Response {
+		response, ok := responses[req.Method+" "+req.URL.String()]
+		if !ok {
+			panic("undeclared request: " + req.Method + " " + req.URL.String())
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(response)),
+			Header:     make(http.Header),
+		}
+	})
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.ResumeJob("job-id", "A")
+	jr.JobRun = JobRun{ServiceId: "service-id", Label: "one-way"}
+	jr.CreateInput()
+
+	result, err := jr.CollectResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Name() != "service-id/A/one-way" {
+		t.Errorf("unexpected name %v", result.Name())
+	}
+	if result.Duration().Seconds() != 30 {
+		t.Errorf("expected duration of 30s, got %v", result.Duration())
+	}
+	if !reflect.DeepEqual(result.UnansweredInputKeys, []string{"selectedSeats"}) {
+		t.Errorf("expected selectedSeats to be unanswered, got %v", result.UnansweredInputKeys)
+	}
+	if len(result.Events) != 1 || result.Events[0].Type != EventInputUnresolved {
+		t.Errorf("expected unresolved input event, got %v", result.Events)
+	}
+	if len(result.Outputs) != 1 || result.Outputs[0].Key != "availableSeats" {
+		t.Errorf("expected outputs to be collected, got %v", result.Outputs)
+	}
+	if result.Passed() {
+		t.Error("expected result to fail")
+	}
+
+	t.Run("job error", func(t *testing.T) {
+		responses["GET http://api/jobs/job-id"] = `{
+			"id": "job-id",
+			"state": "fail",
+			"error": {"code": "SeatsUnavailable", "category": "website"}
+		}`
+		result, err := jr.CollectResult()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.State != "fail" || result.ErrorCode != "SeatsUnavailable" || result.ErrorCategory != "website" {
+			t.Errorf("unexpected result %v", result)
+		}
+	})
+}
+
+func TestUnansweredInputKeys(t *testing.T) {
+	keys := unansweredInputKeys([]Event{
+		{Type: EventInputUnresolved, Key: "a"},
+		{Type: EventInputUnresolved, Key: "b"},
+		{Type: EventInputUnresolved, Key: "a"},
+		{Type: EventInputSent, Key: "b"},
+	})
+	if !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("expected [a], got %v", keys)
+	}
+}
@@ -0,0 +1,203 @@
+package jobrunner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultTestCards are payment card numbers published for testing by card schemes and payment providers,
+// e.g. 4111 1111 1111 1111 or Stripe 4000 0025 0000 3155. Whole numbers are compared,
+// since their prefixes such as 400000 belong to BIN ranges issuing real cards.
+var DefaultTestCards = []string{
+	// Visa
+	"4111111111111111",
+	"4242424242424242",
+	"4012888888881881",
+	"4000056655665556",
+	"4000002500003155",
+	"4000002760003184",
+	"4000000000003220",
+	"4000000000000002",
+	"4000000000000069",
+	"4000000000000077",
+	"4000000000000119",
+	"4000000000000127",
+	"4000000000009995",
+	// Mastercard
+	"5555555555554444",
+	"5105105105105100",
+	"5200828282828210",
+	"2223003122003222",
+	"2223000048400011",
+	// American Express
+	"378282246310005",
+	"371449635398431",
+	// Discover
+	"6011111111111117",
+	"6011000990139424",
+	// JCB
+	"3530111333300000",
+	// Diners Club
+	"30569309025904",
+	"38520000023237",
+}
+
+// DefaultCardPatterns locate payment card numbers in jib data, see matchPathPattern.
+var DefaultCardPatterns = []string{
+	"**.pan",
+	"**.cardNumber",
+}
+
+// SafetyPolicy prevents RunJob from creating jobs which may cause real purchases, it is checked before any job is created.
+// Base urls are compared ignoring trailing slash, empty base url of a runner is the production one.
+type SafetyPolicy struct {
+	// AllowedBaseUrls lists the only base urls jobs may be created at, any is allowed when empty.
+	AllowedBaseUrls []string `json:"allowedBaseUrls,omitempty"`
+	DeniedBaseUrls  []string `json:"deniedBaseUrls,omitempty"`
+	// AllowedServices lists the only services jobs may be created for, any is allowed when empty.
+	AllowedServices []string `json:"allowedServices,omitempty"`
+	DeniedServices  []string `json:"deniedServices,omitempty"`
+	// ProductionBaseUrls are base urls of production api, defaults to https://api.automationcloud.net.
+	// Jobs are created in production only when AllowProduction is set or Confirm agrees.
+	ProductionBaseUrls []string `json:"productionBaseUrls,omitempty"`
+	AllowProduction    bool     `json:"allowProduction,omitempty"`
+	// Confirm is asked before creating jobs in production, e.g. by prompting a user.
+	Confirm func(baseUrl string, jobRun JobRun) bool `json:"-"`
+	// MaxJobsPerRun caps JobRun.HowMany, not capped when 0.
+	MaxJobsPerRun int `json:"maxJobsPerRun,omitempty"`
+	// CardPatterns locate card numbers in jib data, defaults to DefaultCardPatterns.
+	// Each card must pass Luhn check and either be one of TestCards (defaults to DefaultTestCards)
+	// or start with one of TestCardBins, e.g. BIN range of a sandbox issuer which never issues real cards.
+	CardPatterns []string `json:"cardPatterns,omitempty"`
+	TestCards    []string `json:"testCards,omitempty"`
+	TestCardBins []string `json:"testCardBins,omitempty"`
+}
+
+// SafetyError is returned by RunJob when job run violates JobRunner.Safety policy, no job is created then.
+type SafetyError struct {
+	Reason string
+}
+
+// Error makes string representation of a safety error.
+func (e SafetyError) Error() string {
+	return "unsafe job run: " + e.Reason
+}
+
+// checkRun verifies where and how many jobs job run creates.
+func (p *SafetyPolicy) checkRun(baseUrl string, jobRun JobRun) error {
+	if p == nil {
+		return nil
+	}
+
+	if baseUrl == "" {
+		baseUrl = defaultBaseUrl
+	}
+	if len(p.AllowedBaseUrls) > 0 && !containsUrl(p.AllowedBaseUrls, baseUrl) {
+		return SafetyError{"base url " + baseUrl + " is not allowed"}
+	}
+	if containsUrl(p.DeniedBaseUrls, baseUrl) {
+		return SafetyError{"base url " + baseUrl + " is denied"}
+	}
+
+	if len(p.AllowedServices) > 0 && !containsString(p.AllowedServices, jobRun.ServiceId) {
+		return SafetyError{"service " + jobRun.ServiceId + " is not allowed"}
+	}
+	if containsString(p.DeniedServices, jobRun.ServiceId) {
+		return SafetyError{"service " + jobRun.ServiceId + " is denied"}
+	}
+
+	if p.MaxJobsPerRun > 0 && jobRun.HowMany > p.MaxJobsPerRun {
+		return SafetyError{fmt.Sprintf("%d jobs exceed limit of %d jobs per run", jobRun.HowMany, p.MaxJobsPerRun)}
+	}
+
+	production := p.ProductionBaseUrls
+	if len(production) == 0 {
+		production = []string{defaultBaseUrl}
+	}
+	if containsUrl(production, baseUrl) && !p.AllowProduction && (p.Confirm == nil || !p.Confirm(baseUrl, jobRun)) {
+		return SafetyError{"production base url " + baseUrl + " is not allowed without confirmation"}
+	}
+	return nil
+}
+
+// checkCards verifies that every card number found in data is a test card.
+func (p *SafetyPolicy) checkCards(data map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+
+	patterns := p.CardPatterns
+	if len(patterns) == 0 {
+		patterns = DefaultCardPatterns
+	}
+	cards := p.TestCards
+	if len(cards) == 0 {
+		cards = DefaultTestCards
+	}
+
+	var err error
+	replacePaths(data, patterns, func(value interface{}) (interface{}, bool) {
+		if err == nil {
+			err = checkTestCard(value, cards, p.TestCardBins)
+		}
+		return value, true
+	})
+	return err
+}
+
+// checkTestCard returns SafetyError unless value is a Luhn-valid card number which is one of cards or starts with one of bins.
+func checkTestCard(value interface{}, cards, bins []string) error {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(fmt.Sprint(value))
+	if !luhnValid(number) {
+		return SafetyError{"card " + maskCard(number) + " is not a valid card number"}
+	}
+	if containsString(cards, number) {
+		return nil
+	}
+	for _, bin := range bins {
+		if strings.HasPrefix(number, bin) {
+			return nil
+		}
+	}
+	return SafetyError{"card " + maskCard(number) + " is not a known test card"}
+}
+
+// luhnValid reports whether number consists of 12 to 19 digits with valid Luhn check digit.
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range number {
+		d := int(number[len(number)-1-i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// maskCard hides all but last four characters of card number, so errors do not reveal real cards.
+func maskCard(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+func containsUrl(urls []string, url string) bool {
+	for _, u := range urls {
+		if strings.TrimRight(u, "/") == strings.TrimRight(url, "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestSafetyPolicy(t *testing.T) {
+	created := 0
+	pan := "4111 1111 1111 1111"
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			body = `{"payment": {"card": {"pan": "` + pan + `"}}}`
+		case "POST http://api/jobs", "POST https://api.automationcloud.net/jobs":
+			created++
+			body = `{"id": "job-id"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	run := func(baseUrl string, policy *SafetyPolicy, jobRun JobRun) error {
+		created = 0
+		jr := NewRunner(client, "apikey", baseUrl, "http://jib")
+		jr.Safety = policy
+		if jobRun.ServiceId == "" {
+			jobRun.ServiceId = "service-id"
+		}
+		_, err := jr.RunJob(jobRun)
+		return err
+	}
+
+	t.Run("safe run", func(t *testing.T) {
+		policy := &SafetyPolicy{
+			AllowedBaseUrls: []string{"http://api/"},
+			AllowedServices: []string{"service-id"},
+			MaxJobsPerRun:   2,
+		}
+		if err := run("http://api", policy, JobRun{HowMany: 2}); err != nil || created != 2 {
+			t.Errorf("expected 2 jobs to be created, got %d, %v", created, err)
+		}
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		pan = "4000 1234 5678 9017"
+		defer func() { pan = "4111 1111 1111 1111" }()
+		if err := run("http://api", nil, JobRun{HowMany: 3}); err != nil || created != 3 {
+			t.Errorf("expected jobs to be created without checks, got %d, %v", created, err)
+		}
+	})
+
+	cases := []struct {
+		name    string
+		baseUrl string
+		policy  *SafetyPolicy
+		jobRun  JobRun
+		message string
+	}{
+		{"base url not allowed", "http://api", &SafetyPolicy{AllowedBaseUrls: []string{"http://staging"}}, JobRun{}, "base url http://api is not allowed"},
+		{"base url denied", "http://api", &SafetyPolicy{DeniedBaseUrls: []string{"http://api/"}}, JobRun{}, "base url http://api is denied"},
+		{"service not allowed", "http://api", &SafetyPolicy{AllowedServices: []string{"other"}}, JobRun{}, "service service-id is not allowed"},
+		{"service denied", "http://api", &SafetyPolicy{DeniedServices: []string{"live-service"}}, JobRun{ServiceId: "live-service"}, "service live-service is denied"},
+		{"too many jobs", "http://api", &SafetyPolicy{MaxJobsPerRun: 10}, JobRun{HowMany: 500}, "500 jobs exceed limit of 10 jobs per run"},
+		{"default production", "", &SafetyPolicy{}, JobRun{}, "production base url https://api.automationcloud.net is not allowed without confirmation"},
+		{"custom production", "http://api", &SafetyPolicy{ProductionBaseUrls: []string{"http://api"}}, JobRun{}, "production base url http://api is not allowed without confirmation"},
+		{"production declined", "", &SafetyPolicy{Confirm: func(string, JobRun) bool { return false }}, JobRun{}, "production base url https://api.automationcloud.net is not allowed without confirmation"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := run(c.baseUrl, c.policy, c.jobRun)
+			expectError(t, "unsafe job run: "+c.message, err)
+			if _, ok := err.(SafetyError); !ok || created != 0 {
+				t.Errorf("expected SafetyError without jobs created, got %T and %d jobs", err, created)
+			}
+		})
+	}
+
+	t.Run("production allowed", func(t *testing.T) {
+		if err := run("https://api.automationcloud.net", &SafetyPolicy{AllowProduction: true}, JobRun{}); err != nil || created != 1 {
+			t.Errorf("expected job to be created, got %d, %v", created, err)
+		}
+
+		var confirmed string
+		confirm := func(baseUrl string, jobRun JobRun) bool {
+			confirmed = baseUrl + " " + jobRun.ServiceId
+			return true
+		}
+		if err := run("https://api.automationcloud.net", &SafetyPolicy{Confirm: confirm}, JobRun{}); err != nil || created != 1 {
+			t.Errorf("expected job to be created, got %d, %v", created, err)
+		}
+		if confirmed != "https://api.automationcloud.net service-id" {
+			t.Errorf("expected confirmation to be asked, got %q", confirmed)
+		}
+	})
+
+	t.Run("cards", func(t *testing.T) {
+		defer func() { pan = "4111 1111 1111 1111" }()
+		cards := map[string]string{
+			"4242-4242-4242-4242": "",
+			"378282246310005":     "",
+			"4000 1234 5678 9017": "card ************9017 is not a known test card",
+			"4000 0025 0000 3155": "",
+			"4000 0012 3456 7899": "card ************7899 is not a known test card",
+			"4111111111111111003": "card ***************1003 is not a known test card",
+			"4111 1111 1111 1112": "card ************1112 is not a valid card number",
+			"n/a":                 "card *** is not a valid card number",
+		}
+		for card, message := range cards {
+			pan = card
+			err := run("http://api", &SafetyPolicy{}, JobRun{})
+			if message == "" {
+				if err != nil || created != 1 {
+					t.Errorf("expected job with card %s to be created, got %v", card, err)
+				}
+				continue
+			}
+			expectError(t, "unsafe job run: "+message, err)
+			if created != 0 {
+				t.Errorf("expected no job with card %s to be created", card)
+			}
+		}
+
+		pan = "4000 1234 5678 9017"
+		if err := run("http://api", &SafetyPolicy{TestCards: []string{"4000123456789017"}}, JobRun{}); err != nil {
+			t.Errorf("expected custom test card to be accepted, got %v", err)
+		}
+		if err := run("http://api", &SafetyPolicy{TestCardBins: []string{"4000"}}, JobRun{}); err != nil {
+			t.Errorf("expected card of custom test bin to be accepted, got %v", err)
+		}
+		if err := run("http://api", &SafetyPolicy{CardPatterns: []string{"**.number"}}, JobRun{}); err != nil {
+			t.Errorf("expected only custom card patterns to be checked, got %v", err)
+		}
+	})
+}
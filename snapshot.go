@@ -0,0 +1,140 @@
+package jobrunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Snapshots configures golden-output snapshots, options are:
+// - Dir: directory where snapshot files are stored, required
+// - Ignore: path patterns of volatile fields (e.g. "**.createdAt", "finalPrice.value"), first segment is output key
+// - Update: rewrite snapshot with outputs of current job instead of comparing
+type Snapshots struct {
+	Dir    string   `json:"dir"`
+	Ignore []string `json:"ignore,omitempty"`
+	Update bool     `json:"update,omitempty"`
+}
+
+// Snapshot is a recorded set of job outputs along with an instruction job was run with.
+type Snapshot struct {
+	ServiceId string                 `json:"serviceId"`
+	DomainId  string                 `json:"domainId"`
+	JibConfig JibConfig              `json:"jibConfig"`
+	Overrides *Overrides             `json:"overrides,omitempty"`
+	Vars      map[string]interface{} `json:"vars,omitempty"`
+	Outputs   map[string]interface{} `json:"outputs"`
+}
+
+// SnapshotFile returns location of a snapshot for given job run,
+// the same service, domain, jib config, overrides and vars always map to the same file.
+func (s Snapshots) SnapshotFile(jobRun JobRun) string {
+	key, _ := json.Marshal(Snapshot{
+		ServiceId: jobRun.ServiceId,
+		DomainId:  jobRun.DomainId,
+		JibConfig: jobRun.JibConfig,
+		Overrides: jobRun.Overrides,
+		Vars:      jobRun.Vars,
+	})
+	sum := sha256.Sum256(key)
+	return filepath.Join(s.Dir, jobRun.ServiceId+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// MatchSnapshot compares all outputs of current job with snapshot recorded for jr.JobRun.
+// Outputs are redacted with jr.Redactor before being recorded or compared.
+// Snapshot is recorded when it does not exist yet or when s.Update is set,
+// otherwise one "snapshot" assertion result per output key is produced.
+func (jr *JobRunner) MatchSnapshot(s Snapshots) (results []AssertionResult, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	list, err := jr.fetchOutputs()
+	if err != nil {
+		return
+	}
+
+	outputs := make(map[string]interface{}, len(list))
+	for _, o := range list {
+		outputs[o.Key] = o.Data
+	}
+	outputs, _ = jr.Redactor.Redact(outputs).(map[string]interface{})
+
+	filename := s.SnapshotFile(jr.JobRun)
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) || s.Update {
+		return nil, writeSnapshot(filename, Snapshot{
+			ServiceId: jr.JobRun.ServiceId,
+			DomainId:  jr.JobRun.DomainId,
+			JibConfig: jr.JobRun.JibConfig,
+			Overrides: jr.JobRun.Overrides.redact(jr.Redactor),
+			Vars:      jr.JobRun.Vars,
+			Outputs:   outputs,
+		})
+	}
+	if err != nil {
+		return
+	}
+
+	var snapshot Snapshot
+	if err = decodeJSON(b, &snapshot); err != nil {
+		return
+	}
+
+	return diffSnapshot(snapshot.Outputs, outputs, s.Ignore), nil
+}
+
+func diffSnapshot(expected, actual map[string]interface{}, ignore []string) (results []AssertionResult) {
+	drop := func(interface{}) (interface{}, bool) { return nil, false }
+	expected, _ = replacePaths(expected, ignore, drop).(map[string]interface{})
+	actual, _ = replacePaths(actual, ignore, drop).(map[string]interface{})
+
+	keys := make([]string, 0, len(expected)+len(actual))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	for k := range actual {
+		if _, ok := expected[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var diff []string
+		e, eok := expected[key]
+		a, aok := actual[key]
+		switch {
+		case !aok:
+			diff = []string{"output missing, expected " + toJSON(e)}
+		case !eok:
+			diff = []string{"unexpected output " + toJSON(a)}
+		default:
+			diff = diffValues("", e, a)
+		}
+		results = append(results, AssertionResult{
+			OutputKey: key,
+			Check:     "snapshot",
+			Passed:    len(diff) == 0,
+			Diff:      strings.Join(diff, "\n"),
+		})
+	}
+	return
+}
+
+func writeSnapshot(filename string, snapshot Snapshot) error {
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,110 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestMatchSnapshot(t *testing.T) {
+	outputs := `{"data": [
+		{"key": "finalPrice", "data": {"value": 100, "currencyCode": "gbp"}},
+		{"key": "booking", "data": {"reference": "ABC", "createdAt": 1}}
+	]}`
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch req.URL.String() {
+		case "http://api/jobs/job-id":
+			body = `{"id": "job-id", "state": "success"}`
+		case "http://api/jobs/job-id/outputs":
+			body = outputs
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jr := NewRunner(client, "apikey", "http://api", "http://jib")
+	jr.ResumeJob("job-id", "A")
+	jr.JobRun = JobRun{ServiceId: "service-id", DomainId: "A", JibConfig: JibConfig{"route": "LHR-JFK"}}
+	snapshots := Snapshots{Dir: dir, Ignore: []string{"**.createdAt"}}
+
+	t.Run("records missing snapshot", func(t *testing.T) {
+		results, err := jr.MatchSnapshot(snapshots)
+		if err != nil || len(results) != 0 {
+			t.Errorf("expected snapshot to be recorded, got %v, %v", results, err)
+		}
+		if _, err := os.Stat(snapshots.SnapshotFile(jr.JobRun)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("ignores volatile fields", func(t *testing.T) {
+		outputs = `{"data": [
+			{"key": "finalPrice", "data": {"value": 100, "currencyCode": "gbp"}},
+			{"key": "booking", "data": {"reference": "ABC", "createdAt": 2}}
+		]}`
+		results, err := jr.MatchSnapshot(snapshots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !AllPassed(results) || len(results) != 2 {
+			t.Errorf("expected all outputs to match, got %v", results)
+		}
+	})
+
+	t.Run("reports differences", func(t *testing.T) {
+		outputs = `{"data": [{"key": "finalPrice", "data": {"value": 120, "currencyCode": "gbp"}}]}`
+		results, err := jr.MatchSnapshot(snapshots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []AssertionResult{
+			{OutputKey: "booking", Check: "snapshot", Diff: `output missing, expected {"reference":"ABC"}`},
+			{OutputKey: "finalPrice", Check: "snapshot", Diff: "value: expected 100, got 120"},
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, results)
+		}
+		for i := range expected {
+			if results[i] != expected[i] {
+				t.Errorf("expected %v, got %v", expected[i], results[i])
+			}
+		}
+	})
+
+	t.Run("update mode rewrites snapshot", func(t *testing.T) {
+		update := snapshots
+		update.Update = true
+		if _, err := jr.MatchSnapshot(update); err != nil {
+			t.Fatal(err)
+		}
+		results, _ := jr.MatchSnapshot(snapshots)
+		if !AllPassed(results) || len(results) != 1 {
+			t.Errorf("expected updated snapshot to match, got %v", results)
+		}
+	})
+}
+
+func TestSnapshotFile(t *testing.T) {
+	s := Snapshots{Dir: "snapshots"}
+	a := s.SnapshotFile(JobRun{ServiceId: "s", JibConfig: JibConfig{"a": 1, "b": 2}})
+	b := s.SnapshotFile(JobRun{ServiceId: "s", JibConfig: JibConfig{"b": 2, "a": 1}})
+	c := s.SnapshotFile(JobRun{ServiceId: "s", JibConfig: JibConfig{"a": 2}})
+	if a != b {
+		t.Errorf("expected same config to map to the same file, got %v and %v", a, b)
+	}
+	if a == c {
+		t.Error("expected different configs to map to different files")
+	}
+}
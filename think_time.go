@@ -0,0 +1,102 @@
+package jobrunner
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// EventThinkTime is recorded when runner pauses before answering input, see JobRun.ThinkTimes.
+const EventThinkTime = "thinkTime"
+
+// ThinkTimeAnyKey configures think time of inputs without own configuration.
+const ThinkTimeAnyKey = "*"
+
+// timeNow and timeSleep are replaced in tests.
+var (
+	timeNow   = time.Now
+	timeSleep = time.Sleep
+)
+
+// ThinkTimeModel is a distribution of pauses.
+type ThinkTimeModel string
+
+// Think time models.
+const (
+	// ThinkTimeFixed always pauses for Duration.
+	ThinkTimeFixed ThinkTimeModel = "fixed"
+	// ThinkTimeUniform pauses for a duration picked uniformly between Min and Max.
+	ThinkTimeUniform ThinkTimeModel = "uniform"
+	// ThinkTimeLogNormal pauses for a log-normally distributed duration with given Median and Sigma
+	// (standard deviation of its logarithm), it is capped by Max when set. Real users are modeled this way:
+	// most answer quickly, few take much longer.
+	ThinkTimeLogNormal ThinkTimeModel = "logNormal"
+)
+
+// ThinkTime simulates a user taking time to answer input, e.g. reading price before consenting to it.
+type ThinkTime struct {
+	Model    ThinkTimeModel `json:"model"`
+	Duration time.Duration  `json:"duration,omitempty"`
+	Min      time.Duration  `json:"min,omitempty"`
+	Max      time.Duration  `json:"max,omitempty"`
+	Median   time.Duration  `json:"median,omitempty"`
+	Sigma    float64        `json:"sigma,omitempty"`
+}
+
+// Pick draws a pause from the distribution.
+func (t ThinkTime) Pick() (time.Duration, error) {
+	switch t.Model {
+	case ThinkTimeFixed:
+		return t.Duration, nil
+	case ThinkTimeUniform:
+		if t.Max < t.Min {
+			return 0, errors.New("uniform think time requires min not greater than max")
+		}
+		return t.Min + time.Duration(rand.Int63n(int64(t.Max-t.Min)+1)), nil
+	case ThinkTimeLogNormal:
+		if t.Median <= 0 || t.Sigma < 0 {
+			return 0, errors.New("log-normal think time requires positive median and non-negative sigma")
+		}
+		d := time.Duration(float64(t.Median) * math.Exp(t.Sigma*rand.NormFloat64()))
+		if t.Max > 0 && d > t.Max {
+			d = t.Max
+		}
+		return d, nil
+	}
+	return 0, errors.New("unknown think time model " + string(t.Model))
+}
+
+// think returns what is left of the pause taken before current job's awaited input is answered.
+// Pause is picked once per input key and stage and counts from the first call.
+func (jr *JobRunner) think() (time.Duration, error) {
+	if jr.Job == nil {
+		return 0, nil
+	}
+
+	key, stage := jr.Job.AwaitingInputKey, jr.Job.AwaitingInputStage
+	thinkTime, ok := jr.JobRun.ThinkTimes[key]
+	if !ok {
+		thinkTime, ok = jr.JobRun.ThinkTimes[ThinkTimeAnyKey]
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	state := jr.observe(jr.Job)
+	if state.thought != answeredInputKey(key, stage) {
+		d, err := thinkTime.Pick()
+		if err != nil {
+			return 0, errors.New("think time of input " + key + ": " + err.Error())
+		}
+		state.thought, state.thinkUntil = answeredInputKey(key, stage), timeNow().Add(d)
+		if d > 0 {
+			jr.record(Event{Type: EventThinkTime, Key: key, Message: "paused for " + d.String()})
+		}
+	}
+
+	if left := state.thinkUntil.Sub(timeNow()); left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,171 @@
+package jobrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThinkTime(t *testing.T) {
+	var sent []string
+	job := `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+	client := newTestClient(func(req *http.Request) *http.Response {
+		var body string
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "GET http://api/jobs/job-id":
+			body = job
+		case "POST http://api/jobs/job-id/inputs":
+			b, _ := ioutil.ReadAll(req.Body)
+			sent = append(sent, string(b))
+			body = `{}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	var paused []time.Duration
+	var duringPause func()
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	timeSleep = func(d time.Duration) {
+		paused = append(paused, d)
+		clock = clock.Add(d)
+		if duringPause != nil {
+			duringPause()
+		}
+	}
+	defer func() { timeNow, timeSleep = time.Now, time.Sleep }()
+
+	var current *JobRunner
+	run := func(thinkTimes map[string]ThinkTime) (*JobRunner, error) {
+		sent, paused = nil, nil
+		job = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.ThinkTimes = thinkTimes
+		jr.InputData = map[string]interface{}{"passengers": "Bob"}
+		jr.ResumeJob("job-id", "Flight")
+		current = &jr
+		return &jr, jr.CreateInput()
+	}
+
+	t.Run("pause is recorded", func(t *testing.T) {
+		jr, err := run(map[string]ThinkTime{
+			"passengers":    {Model: ThinkTimeFixed, Duration: 3 * time.Second},
+			ThinkTimeAnyKey: {Model: ThinkTimeFixed, Duration: time.Second},
+		})
+		if err != nil || len(sent) != 1 || len(paused) != 1 || paused[0] != 3*time.Second {
+			t.Errorf("expected input to be sent after 3s pause, got %v, %v, %v", sent, paused, err)
+		}
+		if e := jr.Events[0]; e.Type != EventThinkTime || e.Key != "passengers" || e.Message != "paused for 3s" {
+			t.Errorf("expected pause to be recorded, got %v", e)
+		}
+		if e := jr.Events[1]; e.Type != EventInputSent {
+			t.Errorf("expected input to be sent after pause, got %v", e)
+		}
+	})
+
+	t.Run("default think time", func(t *testing.T) {
+		run(map[string]ThinkTime{ThinkTimeAnyKey: {Model: ThinkTimeFixed, Duration: time.Second}})
+		if len(paused) != 1 || paused[0] != time.Second {
+			t.Errorf("expected default pause, got %v", paused)
+		}
+		run(map[string]ThinkTime{"seats": {Model: ThinkTimeFixed, Duration: time.Second}})
+		if len(paused) != 0 || len(sent) != 1 {
+			t.Errorf("expected no pause for other inputs, got %v", paused)
+		}
+	})
+
+	t.Run("runner is unlocked during pause", func(t *testing.T) {
+		var timeline []Event
+		duringPause = func() {
+			timeline = current.Timeline()
+			job = `{"id": "job-id", "state": "fail"}`
+		}
+		defer func() { duringPause = nil }()
+
+		if _, err := run(map[string]ThinkTime{ThinkTimeAnyKey: {Model: ThinkTimeFixed, Duration: time.Second}}); err != nil {
+			t.Fatal(err)
+		}
+		if len(timeline) != 1 || timeline[0].Type != EventThinkTime {
+			t.Errorf("expected timeline to be available during pause, got %v", timeline)
+		}
+		if len(sent) != 0 {
+			t.Errorf("expected input not to be sent when job stopped awaiting it, got %v", sent)
+		}
+	})
+
+	t.Run("input changed during pause", func(t *testing.T) {
+		duringPause = func() {
+			job = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "seats"}`
+			current.InputData["seats"] = "1A"
+			duringPause = nil
+		}
+		defer func() { duringPause = nil }()
+
+		if _, err := run(map[string]ThinkTime{ThinkTimeAnyKey: {Model: ThinkTimeFixed, Duration: time.Second}}); err != nil {
+			t.Fatal(err)
+		}
+		if len(paused) != 2 || len(sent) != 1 || !strings.Contains(sent[0], `"key":"seats"`) {
+			t.Errorf("expected new input to be answered after its own pause, got %v, %v", paused, sent)
+		}
+	})
+
+	t.Run("polling does not block", func(t *testing.T) {
+		sent, paused = nil, nil
+		job = `{"id": "job-id", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		jr.JobRun.ThinkTimes = map[string]ThinkTime{ThinkTimeAnyKey: {Model: ThinkTimeFixed, Duration: time.Minute}}
+		jr.InputData = map[string]interface{}{"passengers": "Bob"}
+		jr.ResumeJob("job-id", "Flight")
+		if _, err := jr.poll(); err != nil || len(sent) != 0 || len(paused) != 0 {
+			t.Errorf("expected poll to leave input for later without sleeping, got %v, %v, %v", sent, paused, err)
+		}
+		clock = clock.Add(time.Minute)
+		if _, err := jr.poll(); err != nil || len(sent) != 1 {
+			t.Errorf("expected input to be sent once think time passed, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("invalid model", func(t *testing.T) {
+		_, err := run(map[string]ThinkTime{ThinkTimeAnyKey: {Model: "gaussian"}})
+		expectError(t, "think time of input passengers: unknown think time model gaussian", err)
+		_, err = run(map[string]ThinkTime{ThinkTimeAnyKey: {Model: ThinkTimeUniform, Min: time.Second}})
+		expectError(t, "think time of input passengers: uniform think time requires min not greater than max", err)
+	})
+}
+
+func TestThinkTimeModels(t *testing.T) {
+	uniform := ThinkTime{Model: ThinkTimeUniform, Min: time.Second, Max: 2 * time.Second}
+	logNormal := ThinkTime{Model: ThinkTimeLogNormal, Median: time.Second, Sigma: 1, Max: 5 * time.Second}
+
+	var below, above int
+	for i := 0; i < 1000; i++ {
+		if d, _ := uniform.Pick(); d < time.Second || d > 2*time.Second {
+			t.Fatalf("expected uniform pause within range, got %v", d)
+		}
+		d, _ := logNormal.Pick()
+		if d <= 0 || d > 5*time.Second {
+			t.Fatalf("expected positive log-normal pause capped by max, got %v", d)
+		}
+		if d < time.Second {
+			below++
+		} else {
+			above++
+		}
+	}
+	if below < 400 || above < 400 {
+		t.Errorf("expected log-normal pauses around median, got %d below and %d above", below, above)
+	}
+
+	if _, err := (ThinkTime{Model: ThinkTimeLogNormal}).Pick(); err == nil || !strings.HasPrefix(err.Error(), "log-normal think time requires") {
+		t.Errorf("expected error for log-normal without median, got %v", err)
+	}
+}
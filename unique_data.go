@@ -0,0 +1,63 @@
+package jobrunner
+
+import (
+	"fmt"
+	"sync"
+)
+
+// generateDatasets generates input data for each of howMany jobs when JobRun.UniqueData is set,
+// at most JobRun.Parallelism generations run at once. Otherwise a single dataset is shared by all jobs.
+func (jr *JobRunner) generateDatasets(jobRun JobRun, howMany int) ([]map[string]interface{}, error) {
+	if !jobRun.UniqueData {
+		data, err := jr.generateData(jobRun, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{data}, nil
+	}
+
+	parallelism := jobRun.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	datasets := make([]map[string]interface{}, howMany)
+	errs := make([]error, howMany)
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range datasets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			datasets[i], errs[i] = jr.generateData(jobRun, i)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("data generation for job %d failed: %v", i+1, err)
+		}
+	}
+	return datasets, nil
+}
+
+// withJobSeed returns a copy of rendered jib config with seed shifted by job index,
+// so seeded jobs of the same run get different yet reproducible data.
+func withJobSeed(config JibConfig, jobIndex int) JibConfig {
+	seed, ok := toFloat(config[JibSeedKey])
+	if !ok || jobIndex == 0 || !isNumber(config[JibSeedKey]) {
+		return config
+	}
+	return WithSeed(config, int64(seed)+int64(jobIndex))
+}
+
+// stash returns input data generated for current job, jobs not created by the runner use jr.InputData.
+func (jr *JobRunner) stash() map[string]interface{} {
+	if state, ok := jr.states[jr.Job.Id]; ok && state.inputData != nil {
+		return state.inputData
+	}
+	return jr.InputData
+}
@@ -0,0 +1,132 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUniqueData(t *testing.T) {
+	var mu sync.Mutex
+	var seeds []float64
+	var created []string
+	running, maxRunning := 0, 0
+	failJib := false
+
+	client := newTestClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var body string
+		status := 200
+		switch request := req.Method + " " + req.URL.String(); request {
+		case "POST http://jib":
+			var config JibConfig
+			json.NewDecoder(req.Body).Decode(&config)
+			seed, _ := config[JibSeedKey].(float64)
+			seeds = append(seeds, seed)
+
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+
+			if failJib {
+				status = 500
+			}
+			body = `{"passengers": [{"name": "passenger ` + strconv.Itoa(int(seed)) + `"}]}`
+		case "POST http://api/jobs":
+			var jcr struct {
+				Input map[string]interface{} `json:"input"`
+			}
+			json.NewDecoder(req.Body).Decode(&jcr)
+			created = append(created, toJSON(jcr.Input["passengers"]))
+			body = `{"id": "job-` + strconv.Itoa(len(created)) + `", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		case "POST http://api/jobs/job-1/inputs", "POST http://api/jobs/job-2/inputs", "POST http://api/jobs/job-3/inputs":
+			body = `{}`
+		case "GET http://api/jobs/job-2":
+			body = `{"id": "job-2", "state": "awaitingInput", "awaitingInputKey": "passengers"}`
+		default:
+			panic("undeclared request: " + request)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}
+	})
+
+	reset := func() {
+		seeds, created = nil, nil
+		running, maxRunning = 0, 0
+	}
+	jobRun := JobRun{
+		ServiceId:   "service-id",
+		JibConfig:   WithSeed(JibConfig{}, 10),
+		HowMany:     3,
+		UniqueData:  true,
+		Parallelism: 2,
+	}
+
+	t.Run("each job gets own data", func(t *testing.T) {
+		reset()
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		if _, err := jr.RunJob(jobRun); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{`[{"name":"passenger 10"}]`, `[{"name":"passenger 11"}]`, `[{"name":"passenger 12"}]`}
+		for i, e := range expected {
+			if created[i] != e {
+				t.Errorf("expected job %d to be created with %s, got %s", i+1, e, created[i])
+			}
+		}
+		if len(seeds) != 3 || maxRunning != 2 {
+			t.Errorf("expected 3 generations with at most 2 at once, got %v with %d at once", seeds, maxRunning)
+		}
+
+		if err := jr.ResumeJob("job-2", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := jr.CreateInput(); err != nil {
+			t.Fatal(err)
+		}
+		timeline := jr.Timeline()
+		if sent := timeline[len(timeline)-1]; sent.JobId != "job-2" || toJSON(sent.Data) != expected[1] {
+			t.Errorf("expected job-2 to be answered with its own data, got %v", sent)
+		}
+	})
+
+	t.Run("shared data by default", func(t *testing.T) {
+		reset()
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		shared := jobRun
+		shared.UniqueData = false
+		if _, err := jr.RunJob(shared); err != nil {
+			t.Fatal(err)
+		}
+		if len(seeds) != 1 || len(created) != 3 || created[0] != created[2] {
+			t.Errorf("expected jobs to share data generated once, got %v", created)
+		}
+	})
+
+	t.Run("generation failure", func(t *testing.T) {
+		reset()
+		failJib = true
+		defer func() { failJib = false }()
+		jr := NewRunner(client, "apikey", "http://api", "http://jib")
+		_, err := jr.RunJob(jobRun)
+		expectError(t, "data generation for job 1 failed: data generation failed", err)
+		if len(created) != 0 {
+			t.Errorf("expected no jobs to be created, got %v", created)
+		}
+	})
+}